@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+// whoxAccountToken marks our own WHOX queries so their replies can be told apart
+const whoxAccountToken = "152"
+
+// AccountTracker keeps track of the services account each nick is logged in to
+type AccountTracker struct {
+	mu       sync.Mutex
+	accounts map[string]string // lowercase nick -> account
+}
+
+// NewAccountTracker creates an empty account tracker
+func NewAccountTracker() *AccountTracker {
+	return &AccountTracker{accounts: make(map[string]string)}
+}
+
+// Get returns the account of a nick, or an empty string if it is unknown or logged out
+func (t *AccountTracker) Get(nick string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.accounts[strings.ToLower(nick)]
+}
+
+// Set stores the account of a nick. "*" and "0" mean logged out.
+func (t *AccountTracker) Set(nick, account string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if account == "" || account == "*" || account == "0" {
+		delete(t.accounts, strings.ToLower(nick))
+		return
+	}
+	t.accounts[strings.ToLower(nick)] = account
+}
+
+// Rename moves the account of a nick to its new nick
+func (t *AccountTracker) Rename(oldNick, newNick string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if account, exists := t.accounts[strings.ToLower(oldNick)]; exists {
+		delete(t.accounts, strings.ToLower(oldNick))
+		t.accounts[strings.ToLower(newNick)] = account
+	}
+}
+
+// Remove forgets a nick
+func (t *AccountTracker) Remove(nick string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.accounts, strings.ToLower(nick))
+}
+
+// observe updates the tracker from the account tag that account-tag adds to messages
+func (t *AccountTracker) observe(e ircmsg.Message) {
+	if e.Source == "" || !strings.Contains(e.Source, "!") {
+		return
+	}
+	if present, account := e.GetTag("account"); present {
+		t.Set(e.Nick(), account)
+	}
+}
+
+// Function to request the details of everyone in a channel, including accounts when the server supports WHOX
+func requestChannelWho(connection *Connection, channel string) {
+	if _, supported := connection.ISupport()["WHOX"]; !supported {
+		connection.Send("WHO", channel)
+		return
+	}
+	connection.Send("WHO", channel, "%tcuhnfa,"+whoxAccountToken)
+}
+
+// Function to handle ACCOUNT messages from account-notify
+func handleAccount(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 0 {
+		connection.Accounts.Set(e.Nick(), e.Params[0])
+	}
+}
+
+// Function to handle WHOX replies requested by requestChannelWho
+func handleWhoxReply(connection *Connection, e ircmsg.Message, users map[string]User) {
+	// <me> <token> <channel> <user> <host> <nick> <flags> <account>
+	if len(e.Params) < 8 || e.Params[1] != whoxAccountToken {
+		return
+	}
+	connection.Accounts.Set(e.Params[5], e.Params[7])
+	connection.Channels.updateFromWho(e.Params[2], e.Params[5], e.Params[3], e.Params[4], e.Params[6])
+}
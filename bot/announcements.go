@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	announcementCheckInterval = 15 * time.Second
+
+	// Runs missed by more than this, say while the bot was down, are skipped instead of sent late
+	announcementMaxDelay = 10 * time.Minute
+)
+
+// Announcement is a message posted to a channel, or set as its topic, on a cron schedule
+type Announcement struct {
+	ID        int       `json:"id"`
+	Network   string    `json:"network"`
+	Channel   string    `json:"channel"`
+	Cron      string    `json:"cron"`
+	Timezone  string    `json:"timezone"`
+	Text      string    `json:"text"`
+	SetTopic  bool      `json:"set_topic,omitempty"`
+	Paused    bool      `json:"paused,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	NextRun   time.Time `json:"next_run"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+}
+
+// announcementData is the layout of the announcements file
+type announcementData struct {
+	NextID        int            `json:"next_id"`
+	Announcements []Announcement `json:"announcements"`
+}
+
+// AnnouncementStore keeps the scheduled announcements
+type AnnouncementStore struct {
+	mu       sync.Mutex
+	filePath string
+	data     announcementData
+}
+
+// LoadAnnouncementStore loads the announcements from a file
+func LoadAnnouncementStore(filePath string) (*AnnouncementStore, error) {
+	s := &AnnouncementStore{filePath: filePath}
+	if err := loadJSON(filePath, &s.data); err != nil {
+		return nil, err
+	}
+	if s.data.NextID == 0 {
+		s.data.NextID = 1
+	}
+	return s, nil
+}
+
+// Schedule returns the parsed cron expression and timezone of an announcement
+func (a Announcement) Schedule() (*CronSchedule, *time.Location, error) {
+	schedule, err := ParseCron(a.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc, err := time.LoadLocation(a.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return schedule, loc, nil
+}
+
+// NextRuns returns the next times an announcement runs after a time
+func (a Announcement) NextRuns(after time.Time, count int) []time.Time {
+	schedule, loc, err := a.Schedule()
+	if err != nil {
+		return nil
+	}
+	var runs []time.Time
+	t := after.In(loc)
+	for len(runs) < count {
+		if t = schedule.Next(t); t.IsZero() {
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs
+}
+
+// Add validates and stores an announcement and returns it with its ID and first run
+func (s *AnnouncementStore) Add(a Announcement) (Announcement, error) {
+	if _, _, err := a.Schedule(); err != nil {
+		return Announcement{}, err
+	}
+	runs := a.NextRuns(time.Now(), 1)
+	if len(runs) == 0 {
+		return Announcement{}, fmt.Errorf("cron expression %q never runs", a.Cron)
+	}
+	a.NextRun = runs[0]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a.ID = s.data.NextID
+	s.data.NextID++
+	s.data.Announcements = append(s.data.Announcements, a)
+	return a, saveJSON(s.filePath, s.data)
+}
+
+// List returns the announcements of a network, optionally only those of one channel
+func (s *AnnouncementStore) List(network, channel string) []Announcement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []Announcement
+	for _, a := range s.data.Announcements {
+		if a.Network == network && (channel == "" || strings.EqualFold(a.Channel, channel)) {
+			result = append(result, a)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Get returns an announcement by ID
+func (s *AnnouncementStore) Get(network string, id int) (Announcement, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.data.Announcements {
+		if a.ID == id && a.Network == network {
+			return a, true
+		}
+	}
+	return Announcement{}, false
+}
+
+// Remove deletes an announcement, reporting whether it existed
+func (s *AnnouncementStore) Remove(network string, id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, a := range s.data.Announcements {
+		if a.ID == id && a.Network == network {
+			s.data.Announcements = append(s.data.Announcements[:i:i], s.data.Announcements[i+1:]...)
+			return true, saveJSON(s.filePath, s.data)
+		}
+	}
+	return false, nil
+}
+
+// SetPaused pauses or resumes an announcement. Resuming schedules the next run from now.
+func (s *AnnouncementStore) SetPaused(network string, id int, paused bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, a := range s.data.Announcements {
+		if a.ID == id && a.Network == network {
+			a.Paused = paused
+			if runs := a.NextRuns(time.Now(), 1); !paused && len(runs) > 0 {
+				a.NextRun = runs[0]
+			}
+			s.data.Announcements[i] = a
+			return true, saveJSON(s.filePath, s.data)
+		}
+	}
+	return false, nil
+}
+
+// takeDue returns the announcements of a network that are due and moves them to their next run
+func (s *AnnouncementStore) takeDue(network string, now time.Time) ([]Announcement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Announcement
+	for i, a := range s.data.Announcements {
+		if a.Network != network || a.Paused || a.NextRun.IsZero() || now.Before(a.NextRun) {
+			continue
+		}
+		if now.Sub(a.NextRun) <= announcementMaxDelay {
+			due = append(due, a)
+			a.LastRun = now
+		} else {
+			color.Yellow(">> Skipping announcement %d in %s, it was due at %s", a.ID, a.Channel, a.NextRun.Format(time.RFC1123))
+		}
+		if runs := a.NextRuns(now, 1); len(runs) > 0 {
+			a.NextRun = runs[0]
+		} else {
+			a.NextRun = time.Time{}
+		}
+		s.data.Announcements[i] = a
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	return due, saveJSON(s.filePath, s.data)
+}
+
+// FormatAnnouncement fills in the placeholders of an announcement:
+// {date}, {time}, {weekday}, {channel}, {network}, {members} and {topic}
+func FormatAnnouncement(connection *Connection, a Announcement, at time.Time) string {
+	_, loc, err := a.Schedule()
+	if err != nil {
+		loc = time.UTC
+	}
+	local := at.In(loc)
+	return strings.NewReplacer(
+		"{date}", local.Format("2006-01-02"),
+		"{time}", local.Format("15:04"),
+		"{weekday}", local.Weekday().String(),
+		"{channel}", a.Channel,
+		"{network}", connection.Network.Name,
+		"{members}", strconv.Itoa(len(connection.Channels.Members(a.Channel))),
+		"{topic}", connection.Channels.Topic(a.Channel),
+	).Replace(a.Text)
+}
+
+// sendDueAnnouncements posts announcements when they are due, for as long as the bot runs
+func sendDueAnnouncements(connection *Connection) {
+	ticker := time.NewTicker(announcementCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !connection.Connected() || connection.CurrentNick() == "" {
+			continue
+		}
+		now := time.Now()
+		due, err := connection.Network.Announcements.takeDue(connection.Network.Name, now)
+		if err != nil {
+			color.Red(">> Error saving announcements: %v", err)
+		}
+		for _, a := range due {
+			if !connection.Channels.IsOn(a.Channel, connection.CurrentNick()) {
+				color.Yellow(">> Skipping announcement %d, the bot is not in %s", a.ID, a.Channel)
+				continue
+			}
+			text := FormatAnnouncement(connection, a, now)
+			color.Green(">> Announcement %d in %s", a.ID, a.Channel)
+			if a.SetTopic {
+				connection.Send("TOPIC", a.Channel, text)
+			} else {
+				connection.SendLong(a.Channel, text)
+			}
+		}
+	}
+}
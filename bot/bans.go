@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Ban mask styles
+const (
+	BanMaskHost     = "host"      // *!*@host
+	BanMaskUserHost = "user_host" // *!*user@host
+	BanMaskNick     = "nick"      // nick!*@*
+	BanMaskFull     = "full"      // nick!*user@host
+)
+
+// How often expired bans are looked for
+const banCheckInterval = 30 * time.Second
+
+// TimedBan is a ban or quiet the bot set that it will lift once it expires
+type TimedBan struct {
+	Network   string    `json:"network"`
+	Channel   string    `json:"channel"`
+	Mode      string    `json:"mode,omitempty"` // the list mode, b when empty
+	Mask      string    `json:"mask"`
+	Nick      string    `json:"nick"`
+	SetBy     string    `json:"set_by"`
+	Reason    string    `json:"reason,omitempty"`
+	SetAt     time.Time `json:"set_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ListMode returns the channel list mode the ban was set with
+func (b TimedBan) ListMode() string {
+	if b.Mode == "" {
+		return "b"
+	}
+	return b.Mode
+}
+
+// BanStore keeps timed bans in a file so they are still lifted after a restart
+type BanStore struct {
+	mu       sync.Mutex
+	filePath string
+	bans     []TimedBan
+}
+
+// LoadBanStore loads the timed bans from a file
+func LoadBanStore(filePath string) (*BanStore, error) {
+	store := &BanStore{filePath: filePath}
+	if err := loadJSON(filePath, &store.bans); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Add stores a timed ban, replacing an older one on the same mask
+func (s *BanStore) Add(ban TimedBan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bans = s.without(ban)
+	s.bans = append(s.bans, ban)
+	return saveJSON(s.filePath, s.bans)
+}
+
+// Remove forgets a timed ban, reporting whether it existed
+func (s *BanStore) Remove(ban TimedBan) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remaining := s.without(ban)
+	if len(remaining) == len(s.bans) {
+		return false, nil
+	}
+	s.bans = remaining
+	return true, saveJSON(s.filePath, s.bans)
+}
+
+// Find returns the timed ban (not quiet) in a channel matching a mask or nick
+func (s *BanStore) Find(network, channel, maskOrNick string) (TimedBan, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ban := range s.bans {
+		if ban.Network == network && strings.EqualFold(ban.Channel, channel) && ban.ListMode() == "b" &&
+			(strings.EqualFold(ban.Mask, maskOrNick) || strings.EqualFold(ban.Nick, maskOrNick)) {
+			return ban, true
+		}
+	}
+	return TimedBan{}, false
+}
+
+// List returns the timed bans of a channel, soonest to expire first
+func (s *BanStore) List(network, channel string) []TimedBan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []TimedBan
+	for _, ban := range s.bans {
+		if ban.Network == network && strings.EqualFold(ban.Channel, channel) {
+			result = append(result, ban)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ExpiresAt.Before(result[j].ExpiresAt) })
+	return result
+}
+
+// expired returns the bans of a network that have run out
+func (s *BanStore) expired(network string, now time.Time) []TimedBan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []TimedBan
+	for _, ban := range s.bans {
+		if ban.Network == network && !now.Before(ban.ExpiresAt) {
+			result = append(result, ban)
+		}
+	}
+	return result
+}
+
+// without returns the bans except the given one. The caller holds the lock.
+func (s *BanStore) without(other TimedBan) []TimedBan {
+	result := make([]TimedBan, 0, len(s.bans))
+	for _, ban := range s.bans {
+		if ban.Network == other.Network && strings.EqualFold(ban.Channel, other.Channel) &&
+			ban.ListMode() == other.ListMode() && strings.EqualFold(ban.Mask, other.Mask) {
+			continue
+		}
+		result = append(result, ban)
+	}
+	return result
+}
+
+// BuildBanMask builds a ban mask for a user in the given style
+func BuildBanMask(style, nick, user, host string) string {
+	// Idents without identd start with ~, which is left to the wildcard
+	user = "*" + strings.TrimPrefix(user, "~")
+
+	switch style {
+	case BanMaskUserHost:
+		return "*!" + user + "@" + host
+	case BanMaskNick:
+		return nick + "!*@*"
+	case BanMaskFull:
+		return nick + "!" + user + "@" + host
+	default:
+		return "*!*@" + host
+	}
+}
+
+// ParseDuration parses durations such as 30m, 2h, 1d12h or 1w. Days and weeks are
+// accepted on top of what time.ParseDuration understands.
+func ParseDuration(s string) (time.Duration, error) {
+	var total time.Duration
+	rest := strings.ToLower(s)
+	for _, unit := range []struct {
+		suffix string
+		length time.Duration
+	}{{"w", 7 * 24 * time.Hour}, {"d", 24 * time.Hour}} {
+		if i := strings.Index(rest, unit.suffix); i >= 0 {
+			var n int
+			if _, err := fmt.Sscanf(rest[:i], "%d", &n); err != nil || fmt.Sprint(n) != rest[:i] {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			total += time.Duration(n) * unit.length
+			rest = rest[i+1:]
+		}
+	}
+	if rest != "" {
+		d, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += d
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return total, nil
+}
+
+// liftExpiredBans removes expired bans in the channels the bot is in, for as long as the bot runs.
+// Bans in channels the bot has not joined yet are lifted once it is back in them.
+func liftExpiredBans(connection *Connection) {
+	ticker := time.NewTicker(banCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !connection.Connected() {
+			continue
+		}
+		for _, ban := range connection.Network.Bans.expired(connection.Network.Name, time.Now()) {
+			if !connection.Channels.IsOn(ban.Channel, connection.CurrentNick()) {
+				continue
+			}
+			color.Green(">> Lifting expired +%s %s in %s", ban.ListMode(), ban.Mask, ban.Channel)
+			connection.Send("MODE", ban.Channel, "-"+ban.ListMode(), ban.Mask)
+			if _, err := connection.Network.Bans.Remove(ban); err != nil {
+				color.Red(">> Error saving bans: %v", err)
+			}
+		}
+	}
+}
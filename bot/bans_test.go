@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	const day = 24 * time.Hour
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"30s", 30 * time.Second},
+		{"30m", 30 * time.Minute},
+		{"2h", 2 * time.Hour},
+		{"1h30m", 90 * time.Minute},
+		{"1d", day},
+		{"1d2h", day + 2*time.Hour},
+		{"1d12h30m", day + 12*time.Hour + 30*time.Minute},
+		{"2D", 2 * day},
+		{"1w", 7 * day},
+		{"1w2d", 9 * day},
+		{"1w1d1h", 8*day + time.Hour},
+		{"1.5h", 90 * time.Minute},
+	}
+	for _, test := range tests {
+		got, err := ParseDuration(test.input)
+		if err != nil {
+			t.Errorf("ParseDuration(%q): %v", test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseDurationErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"0m",
+		"0d",
+		"-1h",
+		"30",
+		"abc",
+		"d",
+		"1.5d",
+		"2h1d",
+		"1d1w",
+		"xd",
+		"1dd",
+		"1 d",
+	} {
+		if got, err := ParseDuration(input); err == nil {
+			t.Errorf("ParseDuration(%q) = %v, want an error", input, got)
+		}
+	}
+}
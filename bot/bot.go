@@ -14,61 +14,123 @@ import (
 type Bot struct {
 	Connection *Connection
 	Config     *config.Config
+	Network    *Network
 }
 
 // Connection is a wrapper around ircevent.Connection
 type Connection struct {
 	*ircevent.Connection
-	Config *config.Config
+	Config     *config.Config
+	Network    *Network
+	Supervisor *Supervisor
+	Accounts   *AccountTracker
+	Channels   *ChannelTracker
+	Queue      *SendQueue
+	Nicks      *NickManager
+	Protection *Protector
+	Logger     *ChannelLogger
+	Rejoin     *Rejoiner
+
+	hostmask ownHostmask
+	ctcp     *ctcpLimiter
+	invites  *inviteQueue
+	sasl     *saslSession
+	whois    *whoisTracker
 }
 
-// PendingWhois stores pending WHOIS requests
+// Registry of connections so commands can find the network they were called on
 var (
-	PendingWhois = make(map[string]func(string))
-	WhoisMu      sync.Mutex
+	connections   = make(map[*ircevent.Connection]*Connection)
+	connectionsMu sync.Mutex
 )
 
-// NewBot creates a new bot instance
-func NewBot(cfg *config.Config, users map[string]User) *Bot {
+// NewBot creates a new bot instance for a network
+func NewBot(network *Network) *Bot {
+	cfg := network.Config
+	users := network.Users
+
 	ircCon := &ircevent.Connection{
-		Server:       cfg.Server + ":" + cfg.Port,
-		Nick:         cfg.Nick,
-		UseTLS:       cfg.UseTLS,
-		TLSConfig:    cfg.TLSConfig,
-		SASLLogin:    cfg.NickServUser,
-		SASLPassword: cfg.NickServPass,
-		RequestCaps:  []string{"server-time", "message-tags", "account-tag"},
+		Server:      cfg.Server + ":" + cfg.Port,
+		Nick:        cfg.Nick,
+		RequestCaps: []string{"server-time", "message-tags", "account-tag", "account-notify", "extended-join", "multi-prefix", "userhost-in-names", "chghost", "batch", "draft/multiline"},
 	}
 
 	conn := &Connection{
 		Connection: ircCon,
 		Config:     cfg,
+		Network:    network,
+		Supervisor: newSupervisor(ircCon, cfg),
+		Accounts:   NewAccountTracker(),
+		Queue:      newSendQueue(ircCon, cfg),
+		ctcp:       newCTCPLimiter(),
+		invites:    newInviteQueue(),
+		whois:      newWhoisTracker(),
+	}
+	conn.Channels = NewChannelTracker(conn)
+	conn.Nicks = newNickManager(conn, cfg)
+	conn.Protection = newProtector(conn, cfg)
+	conn.Logger = NewChannelLogger(network.Dir, network.Name, cfg.Logging)
+	conn.Rejoin = newRejoiner(conn, cfg)
+	conn.Queue.sent = conn.logSent
+	// TLS is set up by the supervisor's dialer and SASL by the bot, ircevent only supports SASL PLAIN
+	if conn.sasl = newSASLSession(conn, cfg); conn.sasl != nil {
+		ircCon.RequestCaps = append(ircCon.RequestCaps, "sasl")
+		conn.Supervisor.wrap = conn.sasl.wrap
+		conn.sasl.register()
 	}
+	go liftExpiredBans(conn)
+	go sendDueReminders(conn)
+	go sendDueAnnouncements(conn)
+
+	// Channel state is rebuilt from the joins after reconnecting, and queued lines are stale by then
+	ircCon.AddDisconnectCallback(func(e ircmsg.Message) {
+		conn.Channels.clear()
+		conn.Queue.Clear()
+		conn.Rejoin.reset()
+		conn.whois.reset()
+	})
 
 	bot := &Bot{
 		Connection: conn,
 		Config:     cfg,
+		Network:    network,
 	}
 
+	connectionsMu.Lock()
+	connections[ircCon] = conn
+	connectionsMu.Unlock()
+
 	bot.Connection.AddConnectCallback(func(e ircmsg.Message) {
-		color.Green(">> Connection successful")
+		color.Green(">> Connection to %s (%s) successful", network.Name, cfg.Server)
+		bot.Connection.Supervisor.handleConnect()
+
+		// Identify the old way when SASL did not log the bot in
+		if sasl := bot.Connection.sasl; sasl != nil {
+			sasl.finish(false, "registration ended without it")
+			if sasl.needsIdentify() {
+				color.Yellow(">> Identifying to NickServ as %s", cfg.NickServUser)
+				bot.Connection.Privmsg("NickServ", fmt.Sprintf("IDENTIFY %s %s", cfg.NickServUser, cfg.NickServPass))
+			}
+		}
 
 		// Check if an owner is set in the users map during connection
 		ownerFound := false
 		for _, user := range users {
 			if user.Roles["*"] == "Owner" {
 				ownerFound = true
-				fmt.Println(">> Owner found:", user.Hostmask)
+				fmt.Println(">> Owner found:", user.Key())
 				break
 			}
 		}
 
 		if !ownerFound {
-			color.Red(">> Owner not found or invalid in users.json")
+			color.Red(">> Owner not found or invalid in %s", network.UsersPath())
 			AddOwnerPrompt(bot.Connection, users)
 		}
 
-		for _, channel := range cfg.Channels {
+		// Rejoin the configured channels, the saved runtime channels and every channel joined since connecting
+		channels := append(cfg.AutoJoinChannels(), network.Joined.Names(network.Name)...)
+		for _, channel := range bot.Connection.Supervisor.channelsToJoin(channels) {
 			bot.Connection.Join(channel)
 		}
 	})
@@ -85,7 +147,26 @@ func (b *Bot) Connect() error {
 	return b.Connection.Connect()
 }
 
-// Loop starts the bot's main loop
+// Loop starts the bot's main loop. It only returns after Quit, reconnecting
+// with backoff whenever the connection drops.
 func (b *Bot) Loop() {
 	b.Connection.Loop()
 }
+
+// GetConnection returns the bot connection wrapping an ircevent connection
+func GetConnection(irc *ircevent.Connection) *Connection {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+	return connections[irc]
+}
+
+// Connections returns all bot connections
+func Connections() []*Connection {
+	connectionsMu.Lock()
+	defer connectionsMu.Unlock()
+	result := make([]*Connection, 0, len(connections))
+	for _, conn := range connections {
+		result = append(result, conn)
+	}
+	return result
+}
@@ -1,6 +1,8 @@
 package bot
 
 import (
+	"strings"
+
 	"github.com/ergochat/irc-go/ircevent"
 	"github.com/ergochat/irc-go/ircmsg"
 	"github.com/fatih/color"
@@ -300,8 +302,15 @@ var replyCodes = map[string]string{
 	"RPL_XINFO":                  "771",
 	"RPL_XINFOSTART":             "773",
 	"RPL_XINFOEND":               "774",
+	"RPL_LOGGEDIN":               "900",
+	"RPL_LOGGEDOUT":              "901",
+	"ERR_NICKLOCKED":             "902",
 	"RPL_SASL_AUTH":              "903",
 	"ERR_SASL_AUTH":              "904",
+	"ERR_SASLTOOLONG":            "905",
+	"ERR_SASLABORTED":            "906",
+	"ERR_SASLALREADY":            "907",
+	"RPL_SASLMECHS":              "908",
 	"ERR_CANNOTDOCOMMAND":        "972",
 	"ERR_CANNOTCHANGEUMODE":      "973",
 	"ERR_CANNOTCHANGECHANMODE":   "974",
@@ -407,11 +416,6 @@ func RegisterCallbacks(connection *ircevent.Connection) {
 				color.Red(">> Erroneous nickname: %s", e.Params[1])
 			}
 		},
-		"ERR_NICKNAMEINUSE": func(e ircmsg.Message) {
-			if len(e.Params) > 1 {
-				color.Red(">> Nickname is already in use: %s", e.Params[1])
-			}
-		},
 		"ERR_USERNOTINCHANNEL": func(e ircmsg.Message) {
 			if len(e.Params) > 2 {
 				color.Red(">> User %s is not in channel %s", e.Params[1], e.Params[2])
@@ -496,24 +500,34 @@ func RegisterCallbacks(connection *ircevent.Connection) {
 				nick := e.Params[1]
 				hostmask := e.Params[2] + "@" + e.Params[3]
 				color.Green(">> WHOIS user: %s, hostmask: %s", nick, hostmask)
-				WhoisMu.Lock()
-				if callback, exists := PendingWhois[nick]; exists {
-					delete(PendingWhois, nick)
-					callback(hostmask)
+				if conn := GetConnection(connection); conn != nil {
+					conn.whois.user(nick, hostmask)
+				}
+			}
+		},
+		"RPL_WHOISCHANNELS": func(e ircmsg.Message) {
+			if len(e.Params) > 2 {
+				if conn := GetConnection(connection); conn != nil {
+					conn.whois.channels(e.Params[1], strings.Fields(e.Params[2]))
+				}
+			}
+		},
+		"RPL_WHOISACCOUNT": func(e ircmsg.Message) {
+			if len(e.Params) > 2 {
+				color.Green(">> WHOIS account: %s is logged in as %s", e.Params[1], e.Params[2])
+				if conn := GetConnection(connection); conn != nil {
+					conn.Accounts.Set(e.Params[1], e.Params[2])
 				}
-				WhoisMu.Unlock()
 			}
 		},
 		"RPL_ENDOFWHOIS": func(e ircmsg.Message) {
 			if len(e.Params) > 1 {
 				nick := e.Params[1]
 				color.Cyan(">> End of WHOIS for %s", nick)
-				WhoisMu.Lock()
-				if callback, exists := PendingWhois[nick]; exists {
-					delete(PendingWhois, nick)
-					callback("")
+				// The callbacks run at the end so the account from RPL_WHOISACCOUNT is known
+				if conn := GetConnection(connection); conn != nil {
+					conn.whois.end(nick)
 				}
-				WhoisMu.Unlock()
 			}
 		},
 	}
@@ -0,0 +1,308 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mbot/config"
+
+	"github.com/ergochat/irc-go/ircmsg"
+	"github.com/fatih/color"
+)
+
+// Types of logged events
+const (
+	LogPrivmsg = "privmsg"
+	LogNotice  = "notice"
+	LogAction  = "action"
+	LogJoin    = "join"
+	LogPart    = "part"
+	LogQuit    = "quit"
+	LogKick    = "kick"
+	LogMode    = "mode"
+	LogNick    = "nick"
+	LogTopic   = "topic"
+)
+
+const (
+	logsDirectory    = "logs"
+	logDayLayout     = "2006-01-02"
+	logFileSuffix    = ".log"
+	bytesPerMegabyte = 1024 * 1024
+)
+
+// LogEntry is one line of a channel log
+type LogEntry struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Nick   string    `json:"nick"`
+	Source string    `json:"source,omitempty"`
+	Target string    `json:"target,omitempty"` // the kicked nick or the new nick
+	Text   string    `json:"text,omitempty"`
+}
+
+// channelLogFile is the open log file of a channel for one day
+type channelLogFile struct {
+	file *os.File
+	day  string
+}
+
+// ChannelLogger writes what happens in channels to one file per network, channel and day.
+// Lines are JSON so other features can read them back with Read and ReadRange.
+type ChannelLogger struct {
+	mu       sync.Mutex
+	dir      string
+	enabled  bool
+	exclude  map[string]bool
+	maxBytes int64
+	files    map[string]*channelLogFile
+}
+
+// NewChannelLogger sets up channel logging below a network's data directory
+func NewChannelLogger(dataDir, network string, cfg config.Logging) *ChannelLogger {
+	dir := cfg.Dir
+	if dir == "" {
+		dir = filepath.Join(dataDir, logsDirectory)
+	}
+	l := &ChannelLogger{
+		dir:      filepath.Join(dir, safeFileName(network)),
+		enabled:  cfg.Enabled,
+		exclude:  make(map[string]bool),
+		maxBytes: int64(cfg.MaxChannelMegabytes) * bytesPerMegabyte,
+		files:    make(map[string]*channelLogFile),
+	}
+	for _, channel := range cfg.ExcludeChannels {
+		l.exclude[strings.ToLower(channel)] = true
+	}
+	return l
+}
+
+// Logs reports whether a channel is logged
+func (l *ChannelLogger) Logs(channel string) bool {
+	return l.enabled && !l.exclude[strings.ToLower(channel)]
+}
+
+// Log appends an entry to the log of a channel
+func (l *ChannelLogger) Log(channel string, entry LogEntry) {
+	if !l.Logs(channel) {
+		return
+	}
+	if err := l.write(channel, entry); err != nil {
+		color.Red(">> Error writing the log of %s: %v", channel, err)
+	}
+}
+
+// write appends an entry to the file of the entry's day, switching files when the day changes
+func (l *ChannelLogger) write(channel string, entry LogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding log entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := strings.ToLower(channel)
+	day := entry.Time.UTC().Format(logDayLayout)
+	current, exists := l.files[key]
+	if !exists || current.day != day {
+		if exists {
+			current.file.Close()
+			delete(l.files, key)
+		}
+		dir := l.channelDir(channel)
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return fmt.Errorf("error creating log directory: %w", err)
+		}
+		file, err := os.OpenFile(filepath.Join(dir, day+logFileSuffix), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("error opening log file: %w", err)
+		}
+		current = &channelLogFile{file: file, day: day}
+		l.files[key] = current
+		l.enforceRetention(dir, day)
+	}
+
+	if _, err := current.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing log file: %w", err)
+	}
+	return nil
+}
+
+// enforceRetention deletes the oldest log files of a channel until it fits its size limit.
+// The file of the current day is always kept. The caller holds the lock.
+func (l *ChannelLogger) enforceRetention(dir, today string) {
+	if l.maxBytes <= 0 {
+		return
+	}
+	days, sizes := logDays(dir)
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+	for i := 0; total > l.maxBytes && i < len(days) && days[i] != today; i++ {
+		if err := os.Remove(filepath.Join(dir, days[i]+logFileSuffix)); err != nil {
+			color.Red(">> Error removing old log file: %v", err)
+			return
+		}
+		color.Yellow(">> Removed old log %s of %s", days[i], filepath.Base(dir))
+		total -= sizes[i]
+	}
+}
+
+// Close closes all open log files
+func (l *ChannelLogger) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, current := range l.files {
+		current.file.Close()
+		delete(l.files, key)
+	}
+}
+
+// Days returns the days a channel has logs for, oldest first, as YYYY-MM-DD in UTC
+func (l *ChannelLogger) Days(channel string) []string {
+	days, _ := logDays(l.channelDir(channel))
+	return days
+}
+
+// Read returns the log of a channel for one day, as a UTC date
+func (l *ChannelLogger) Read(channel string, day time.Time) ([]LogEntry, error) {
+	file, err := os.Open(filepath.Join(l.channelDir(channel), day.UTC().Format(logDayLayout)+logFileSuffix))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error opening log file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading log file: %w", err)
+	}
+	return entries, nil
+}
+
+// ReadRange returns the log entries of a channel between two times
+func (l *ChannelLogger) ReadRange(channel string, from, to time.Time) ([]LogEntry, error) {
+	var result []LogEntry
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.Add(24 * time.Hour) {
+		entries, err := l.Read(channel, day)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.Time.Before(from) && !entry.Time.After(to) {
+				result = append(result, entry)
+			}
+		}
+	}
+	return result, nil
+}
+
+// channelDir returns the directory with the logs of a channel
+func (l *ChannelLogger) channelDir(channel string) string {
+	return filepath.Join(l.dir, safeFileName(strings.ToLower(channel)))
+}
+
+// logDays lists the log files in a directory, oldest first, with their sizes
+func logDays(dir string) ([]string, []int64) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil
+	}
+	var days []string
+	for _, file := range files {
+		if day, isLog := strings.CutSuffix(file.Name(), logFileSuffix); isLog && !file.IsDir() {
+			days = append(days, day)
+		}
+	}
+	sort.Strings(days)
+
+	sizes := make([]int64, len(days))
+	for i, day := range days {
+		if info, err := os.Stat(filepath.Join(dir, day+logFileSuffix)); err == nil {
+			sizes[i] = info.Size()
+		}
+	}
+	return days, sizes
+}
+
+// safeFileName makes a network or channel name usable as a file name
+func safeFileName(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_", "\x00", "_").Replace(name)
+}
+
+// messageTime returns the server-time of a message, or the current time without it
+func messageTime(e ircmsg.Message) time.Time {
+	if present, value := e.GetTag("time"); present {
+		if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return t
+		}
+	}
+	return time.Now().UTC()
+}
+
+// logEvent logs a message from the server to a channel
+func (c *Connection) logEvent(channel string, e ircmsg.Message, kind, target, text string) {
+	c.Logger.Log(channel, LogEntry{
+		Time:   messageTime(e),
+		Type:   kind,
+		Nick:   e.Nick(),
+		Source: e.Source,
+		Target: target,
+		Text:   text,
+	})
+}
+
+// logEventEverywhere logs a quit or nick change to every channel the nick was in
+func (c *Connection) logEventEverywhere(nick string, e ircmsg.Message, kind, target, text string) {
+	for _, channel := range c.Channels.ChannelsOf(nick) {
+		c.logEvent(channel, e, kind, target, text)
+	}
+}
+
+// logSent logs the messages the bot itself sends to channels, which the server does not echo
+func (c *Connection) logSent(msg ircmsg.Message) {
+	if len(msg.Params) < 2 || !c.Channels.IsChannel(msg.Params[0]) {
+		return
+	}
+	kind := ""
+	text := msg.Params[1]
+	switch strings.ToUpper(msg.Command) {
+	case "PRIVMSG":
+		kind = LogPrivmsg
+		if command, args, isCTCP := parseCTCP(text); isCTCP {
+			if command != "ACTION" {
+				return
+			}
+			kind, text = LogAction, args
+		}
+	case "NOTICE":
+		kind = LogNotice
+	default:
+		return
+	}
+	c.Logger.Log(msg.Params[0], LogEntry{
+		Time: time.Now().UTC(),
+		Type: kind,
+		Nick: c.CurrentNick(),
+		Text: text,
+	})
+}
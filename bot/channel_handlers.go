@@ -3,28 +3,58 @@ package bot
 import (
 	"strings"
 
+	"mbot/config"
+
 	"github.com/fatih/color"
 )
 
 func handleChannelMessage(connection *Connection, sender, target, message string, users map[string]User) {
 	color.Cyan(">> Channel message in %s from %s: %s", target, sender, message)
 
-	botNick := GetBotNickname(connection.Connection)
+	if connection.Protection.CheckMessage(target, sender, message, users) {
+		return
+	}
+	deliverMemos(connection, sender, target)
+
+	botNick := GetBotNickname(connection)
+	channel := connection.Config.Channel(target)
 
-	if strings.HasPrefix(message, "!") {
-		handleCommand(connection.Connection, sender, target, message, users)
+	// Channels with a prefix of their own use it in place of the ! that commands are registered with
+	if prefix := channel.CommandPrefix(); strings.HasPrefix(message, prefix) {
+		if channel.FeatureEnabled(config.FeatureCommands) {
+			handleCommand(connection, sender, target, config.DefaultCommandPrefix+strings.TrimPrefix(message, prefix), users)
+		}
 		return
 	}
 
-	if TriviaStateInstance.Active {
+	if TriviaStateInstance.Active && channel.FeatureEnabled(config.FeatureTrivia) {
 		checkTriviaAnswer(sender, message, target, connection)
 	}
 
-	if strings.Contains(message, botNick) {
+	if strings.Contains(message, botNick) && channel.FeatureEnabled(config.FeatureAI) {
 		CallOpenAI(connection, sender, target, message)
 		return
 	}
 
+	if channel.FeatureEnabled(config.FeatureURLs) {
+		handleURLs(connection, sender, target, message)
+	}
+}
+
+// Function to handle /me actions in a channel. They never run commands or reach the AI.
+func handleChannelAction(connection *Connection, sender, target, action string, users map[string]User) {
+	color.Cyan(">> Action in %s: * %s %s", target, ExtractNickname(sender), action)
+
+	if connection.Protection.CheckMessage(target, sender, action, users) {
+		return
+	}
+	if connection.Config.Channel(target).FeatureEnabled(config.FeatureURLs) {
+		handleURLs(connection, sender, target, action)
+	}
+}
+
+// Function to look up every URL in a message
+func handleURLs(connection *Connection, sender, target, message string) {
 	urls := FindURLs(message)
 	if len(urls) > 0 {
 		for _, url := range urls {
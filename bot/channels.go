@@ -0,0 +1,704 @@
+package bot
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+// Defaults used when the server does not advertise PREFIX, CHANMODES or CHANTYPES
+const (
+	defaultPrefix    = "(ov)@+"
+	defaultChanModes = "beI,k,l,imnpst"
+	defaultChanTypes = "#&"
+)
+
+// Member is a user in a channel
+type Member struct {
+	Nick    string
+	User    string
+	Host    string
+	Account string // Filled in from the account tracker when the member is read
+	Modes   string // Prefix modes such as "ov", highest first
+}
+
+// Hostmask returns the member's nick!user@host, or just the nick if the host is unknown
+func (m Member) Hostmask() string {
+	if m.User == "" || m.Host == "" {
+		return m.Nick
+	}
+	return m.Nick + "!" + m.User + "@" + m.Host
+}
+
+// ListEntry is an entry of a channel list mode such as a ban
+type ListEntry struct {
+	Mask  string
+	SetBy string
+	SetAt time.Time
+}
+
+// ChannelState is everything the bot knows about a channel it is in
+type ChannelState struct {
+	Name       string
+	Topic      string
+	TopicSetBy string
+	TopicSetAt time.Time
+	Modes      map[byte]string // Channel modes and their parameters, "" for modes without one
+	Lists      map[byte][]ListEntry
+	Members    map[string]*Member // lowercase nick -> member
+	Synced     bool               // The NAMES list has been received
+}
+
+// Bans returns the ban list of the channel
+func (c *ChannelState) Bans() []ListEntry {
+	return c.Lists['b']
+}
+
+// ModeString formats the channel modes like +ntk key
+func (c *ChannelState) ModeString() string {
+	letters := make([]byte, 0, len(c.Modes))
+	for mode := range c.Modes {
+		letters = append(letters, mode)
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i] < letters[j] })
+
+	var params []string
+	for _, mode := range letters {
+		if c.Modes[mode] != "" {
+			params = append(params, c.Modes[mode])
+		}
+	}
+	return strings.TrimSpace("+" + string(letters) + " " + strings.Join(params, " "))
+}
+
+// copy returns a deep copy that can be used without holding the tracker lock
+func (c *ChannelState) copy() *ChannelState {
+	result := &ChannelState{
+		Name:       c.Name,
+		Topic:      c.Topic,
+		TopicSetBy: c.TopicSetBy,
+		TopicSetAt: c.TopicSetAt,
+		Modes:      make(map[byte]string, len(c.Modes)),
+		Lists:      make(map[byte][]ListEntry, len(c.Lists)),
+		Members:    make(map[string]*Member, len(c.Members)),
+		Synced:     c.Synced,
+	}
+	for mode, param := range c.Modes {
+		result.Modes[mode] = param
+	}
+	for mode, entries := range c.Lists {
+		result.Lists[mode] = append([]ListEntry(nil), entries...)
+	}
+	for key, member := range c.Members {
+		m := *member
+		result.Members[key] = &m
+	}
+	return result
+}
+
+// ChannelTracker keeps the live state of every channel the bot is in
+type ChannelTracker struct {
+	mu       sync.Mutex
+	conn     *Connection
+	channels map[string]*ChannelState // lowercase name -> state
+
+	// Channels whose NAMES or list replies are being received, so a new reply replaces the old data
+	namesPending map[string]bool
+	listsPending map[string]bool
+}
+
+// NewChannelTracker creates an empty channel tracker for a connection
+func NewChannelTracker(conn *Connection) *ChannelTracker {
+	return &ChannelTracker{
+		conn:         conn,
+		channels:     make(map[string]*ChannelState),
+		namesPending: make(map[string]bool),
+		listsPending: make(map[string]bool),
+	}
+}
+
+// Get returns a copy of the state of a channel
+func (t *ChannelTracker) Get(channel string) (*ChannelState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, exists := t.channels[strings.ToLower(channel)]; exists {
+		result := state.copy()
+		for _, member := range result.Members {
+			member.Account = t.conn.Accounts.Get(member.Nick)
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+// IsPrivate reports whether a channel the bot is in is secret (+s) or private (+p)
+func (t *ChannelTracker) IsPrivate(channel string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, exists := t.channels[strings.ToLower(channel)]
+	if !exists {
+		return false
+	}
+	_, secret := state.Modes['s']
+	_, private := state.Modes['p']
+	return secret || private
+}
+
+// Names returns the names of all channels the bot is in
+func (t *ChannelTracker) Names() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.channels))
+	for _, state := range t.channels {
+		names = append(names, state.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Member returns a member of a channel
+func (t *ChannelTracker) Member(channel, nick string) (Member, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, exists := t.channels[strings.ToLower(channel)]; exists {
+		if member, exists := state.Members[strings.ToLower(nick)]; exists {
+			result := *member
+			result.Account = t.conn.Accounts.Get(member.Nick)
+			return result, true
+		}
+	}
+	return Member{}, false
+}
+
+// Members returns all members of a channel, sorted by nick
+func (t *ChannelTracker) Members(channel string) []Member {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, exists := t.channels[strings.ToLower(channel)]
+	if !exists {
+		return nil
+	}
+	members := make([]Member, 0, len(state.Members))
+	for _, member := range state.Members {
+		result := *member
+		result.Account = t.conn.Accounts.Get(member.Nick)
+		members = append(members, result)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return strings.ToLower(members[i].Nick) < strings.ToLower(members[j].Nick)
+	})
+	return members
+}
+
+// ChannelsOf returns the tracked channels a nick is in
+func (t *ChannelTracker) ChannelsOf(nick string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var channels []string
+	for _, state := range t.channels {
+		if _, exists := state.Members[strings.ToLower(nick)]; exists {
+			channels = append(channels, state.Name)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// IsOn reports whether a nick is in a channel
+func (t *ChannelTracker) IsOn(channel, nick string) bool {
+	_, exists := t.Member(channel, nick)
+	return exists
+}
+
+// IsOp reports whether a nick has +o or a higher prefix in a channel
+func (t *ChannelTracker) IsOp(channel, nick string) bool {
+	return t.hasRankAtLeast(channel, nick, 'o')
+}
+
+// IsVoiced reports whether a nick has +v or a higher prefix in a channel
+func (t *ChannelTracker) IsVoiced(channel, nick string) bool {
+	return t.hasRankAtLeast(channel, nick, 'v')
+}
+
+// Function to check whether a member holds a prefix mode ranked at or above the given one
+func (t *ChannelTracker) hasRankAtLeast(channel, nick string, mode byte) bool {
+	member, exists := t.Member(channel, nick)
+	if !exists || member.Modes == "" {
+		return false
+	}
+	modes, _ := t.prefixes()
+	rank := strings.IndexByte(modes, mode)
+	if rank < 0 {
+		return false
+	}
+	for i := 0; i < len(member.Modes); i++ {
+		if r := strings.IndexByte(modes, member.Modes[i]); r >= 0 && r <= rank {
+			return true
+		}
+	}
+	return false
+}
+
+// Prefix returns the highest prefix symbol of a member, such as @ or +
+func (t *ChannelTracker) Prefix(channel, nick string) string {
+	member, exists := t.Member(channel, nick)
+	if !exists || member.Modes == "" {
+		return ""
+	}
+	modes, symbols := t.prefixes()
+	if i := strings.IndexByte(modes, member.Modes[0]); i >= 0 {
+		return string(symbols[i])
+	}
+	return ""
+}
+
+// Topic returns the topic of a channel
+func (t *ChannelTracker) Topic(channel string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, exists := t.channels[strings.ToLower(channel)]; exists {
+		return state.Topic
+	}
+	return ""
+}
+
+// IsChannel reports whether a target is a channel name on this network
+func (t *ChannelTracker) IsChannel(target string) bool {
+	if target == "" {
+		return false
+	}
+	chanTypes := t.conn.ISupport()["CHANTYPES"]
+	if chanTypes == "" {
+		chanTypes = defaultChanTypes
+	}
+	return strings.IndexByte(chanTypes, target[0]) >= 0
+}
+
+// prefixes returns the prefix modes and their symbols from ISUPPORT, such as "ov" and "@+"
+func (t *ChannelTracker) prefixes() (modes, symbols string) {
+	prefix := t.conn.ISupport()["PREFIX"]
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+	modes, symbols, found := strings.Cut(strings.TrimPrefix(prefix, "("), ")")
+	if !found || len(modes) != len(symbols) {
+		modes, symbols, _ = strings.Cut(strings.TrimPrefix(defaultPrefix, "("), ")")
+	}
+	return modes, symbols
+}
+
+// chanModes returns the four CHANMODES groups: list modes, modes that always take a
+// parameter, modes that take one only when set, and modes without a parameter
+func (t *ChannelTracker) chanModes() [4]string {
+	chanModes := t.conn.ISupport()["CHANMODES"]
+	if chanModes == "" {
+		chanModes = defaultChanModes
+	}
+	var groups [4]string
+	copy(groups[:], strings.SplitN(chanModes, ",", 4))
+	return groups
+}
+
+// Function to sort prefix modes highest first
+func sortModes(memberModes, modes string) string {
+	var result []byte
+	for i := 0; i < len(modes); i++ {
+		if strings.IndexByte(memberModes, modes[i]) >= 0 {
+			result = append(result, modes[i])
+		}
+	}
+	return string(result)
+}
+
+// Function to split the prefix symbols off a NAMES or WHO entry and return them as modes
+func splitPrefixes(name, modes, symbols string) (string, string) {
+	var memberModes []byte
+	for name != "" {
+		i := strings.IndexByte(symbols, name[0])
+		if i < 0 {
+			break
+		}
+		memberModes = append(memberModes, modes[i])
+		name = name[1:]
+	}
+	return sortModes(string(memberModes), modes), name
+}
+
+// join adds a member to a channel, creating the channel when the bot itself joins
+func (t *ChannelTracker) join(channel, source string) {
+	nick, user, host := splitSource(source)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := strings.ToLower(channel)
+	if strings.EqualFold(nick, t.conn.CurrentNick()) {
+		t.channels[key] = &ChannelState{
+			Name:    channel,
+			Modes:   make(map[byte]string),
+			Lists:   make(map[byte][]ListEntry),
+			Members: make(map[string]*Member),
+		}
+	}
+
+	state, exists := t.channels[key]
+	if !exists {
+		return
+	}
+	state.Members[strings.ToLower(nick)] = &Member{Nick: nick, User: user, Host: host}
+}
+
+// part removes a member from a channel, or the whole channel when the bot leaves it
+func (t *ChannelTracker) part(channel, nick string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := strings.ToLower(channel)
+	if strings.EqualFold(nick, t.conn.CurrentNick()) {
+		delete(t.channels, key)
+		delete(t.namesPending, key)
+		delete(t.listsPending, key)
+		return
+	}
+	if state, exists := t.channels[key]; exists {
+		delete(state.Members, strings.ToLower(nick))
+	}
+}
+
+// quit removes a nick from every channel
+func (t *ChannelTracker) quit(nick string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, state := range t.channels {
+		delete(state.Members, strings.ToLower(nick))
+	}
+}
+
+// rename moves a member to its new nick in every channel
+func (t *ChannelTracker) rename(oldNick, newNick string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, state := range t.channels {
+		if member, exists := state.Members[strings.ToLower(oldNick)]; exists {
+			delete(state.Members, strings.ToLower(oldNick))
+			member.Nick = newNick
+			state.Members[strings.ToLower(newNick)] = member
+		}
+	}
+}
+
+// changeHost updates the username and host of a nick in every channel
+func (t *ChannelTracker) changeHost(nick, user, host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, state := range t.channels {
+		if member, exists := state.Members[strings.ToLower(nick)]; exists {
+			member.User = user
+			member.Host = host
+		}
+	}
+}
+
+// clear forgets all channels, used when the connection drops
+func (t *ChannelTracker) clear() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channels = make(map[string]*ChannelState)
+	t.namesPending = make(map[string]bool)
+	t.listsPending = make(map[string]bool)
+}
+
+// setTopic updates the topic of a channel
+func (t *ChannelTracker) setTopic(channel, topic, setBy string, setAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, exists := t.channels[strings.ToLower(channel)]; exists {
+		state.Topic = topic
+		state.TopicSetBy = setBy
+		state.TopicSetAt = setAt
+	}
+}
+
+// setTopicWhoTime updates who set the topic and when, from RPL_TOPICWHOTIME
+func (t *ChannelTracker) setTopicWhoTime(channel, setBy string, setAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, exists := t.channels[strings.ToLower(channel)]; exists {
+		state.TopicSetBy = setBy
+		state.TopicSetAt = setAt
+	}
+}
+
+// addNames adds the members of a RPL_NAMREPLY. The first reply of a NAMES list replaces the old members.
+func (t *ChannelTracker) addNames(channel string, names []string) {
+	modes, symbols := t.prefixes()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := strings.ToLower(channel)
+	state, exists := t.channels[key]
+	if !exists {
+		return
+	}
+	if !t.namesPending[key] {
+		t.namesPending[key] = true
+		state.Members = make(map[string]*Member)
+	}
+
+	for _, name := range names {
+		memberModes, source := splitPrefixes(name, modes, symbols)
+		if source == "" {
+			continue
+		}
+		// userhost-in-names sends nick!user@host
+		nick, user, host := splitSource(source)
+		state.Members[strings.ToLower(nick)] = &Member{Nick: nick, User: user, Host: host, Modes: memberModes}
+	}
+}
+
+// endNames marks a channel's NAMES list as complete
+func (t *ChannelTracker) endNames(channel string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := strings.ToLower(channel)
+	delete(t.namesPending, key)
+	if state, exists := t.channels[key]; exists {
+		state.Synced = true
+	}
+}
+
+// updateFromWho fills in a member's details from a WHO or WHOX reply
+func (t *ChannelTracker) updateFromWho(channel, nick, user, host, flags string) {
+	modes, symbols := t.prefixes()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, exists := t.channels[strings.ToLower(channel)]
+	if !exists {
+		return
+	}
+	member, exists := state.Members[strings.ToLower(nick)]
+	if !exists {
+		member = &Member{Nick: nick}
+		state.Members[strings.ToLower(nick)] = member
+	}
+	member.User = user
+	member.Host = host
+
+	// Flags look like H@+ or G*@, where H/G is away status and * marks an IRC operator
+	var memberModes []byte
+	for i := 0; i < len(flags); i++ {
+		if j := strings.IndexByte(symbols, flags[i]); j >= 0 {
+			memberModes = append(memberModes, modes[j])
+		}
+	}
+	member.Modes = sortModes(string(memberModes), modes)
+}
+
+// addListEntry adds an entry from RPL_BANLIST. The first reply of a list replaces the old entries.
+func (t *ChannelTracker) addListEntry(channel string, mode byte, entry ListEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := strings.ToLower(channel)
+	state, exists := t.channels[key]
+	if !exists {
+		return
+	}
+	pendingKey := key + " " + string(mode)
+	if !t.listsPending[pendingKey] {
+		t.listsPending[pendingKey] = true
+		state.Lists[mode] = nil
+	}
+	state.Lists[mode] = append(state.Lists[mode], entry)
+}
+
+// endList marks a list mode reply as complete. A list without entries clears the old ones.
+func (t *ChannelTracker) endList(channel string, mode byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := strings.ToLower(channel)
+	pendingKey := key + " " + string(mode)
+	received := t.listsPending[pendingKey]
+	delete(t.listsPending, pendingKey)
+	if state, exists := t.channels[key]; exists && !received {
+		state.Lists[mode] = nil
+	}
+}
+
+// applyModes applies a mode change to a channel. When reset is set, the current
+// channel modes are replaced, as with RPL_CHANNELMODEIS.
+func (t *ChannelTracker) applyModes(channel, setBy string, modeString string, args []string, reset bool) {
+	prefixModes, _ := t.prefixes()
+	groups := t.chanModes()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, exists := t.channels[strings.ToLower(channel)]
+	if !exists {
+		return
+	}
+	if reset {
+		state.Modes = make(map[byte]string)
+	}
+
+	adding := true
+	nextArg := func() string {
+		if len(args) == 0 {
+			return ""
+		}
+		arg := args[0]
+		args = args[1:]
+		return arg
+	}
+
+	for i := 0; i < len(modeString); i++ {
+		mode := modeString[i]
+		switch {
+		case mode == '+':
+			adding = true
+		case mode == '-':
+			adding = false
+		case strings.IndexByte(prefixModes, mode) >= 0:
+			member, exists := state.Members[strings.ToLower(nextArg())]
+			if !exists {
+				continue
+			}
+			memberModes := strings.ReplaceAll(member.Modes, string(mode), "")
+			if adding {
+				memberModes += string(mode)
+			}
+			member.Modes = sortModes(memberModes, prefixModes)
+		case strings.IndexByte(groups[0], mode) >= 0:
+			mask := nextArg()
+			if mask == "" {
+				continue
+			}
+			entries := state.Lists[mode][:0:0]
+			for _, entry := range state.Lists[mode] {
+				if !strings.EqualFold(entry.Mask, mask) {
+					entries = append(entries, entry)
+				}
+			}
+			if adding {
+				entries = append(entries, ListEntry{Mask: mask, SetBy: setBy, SetAt: time.Now()})
+			}
+			state.Lists[mode] = entries
+		case strings.IndexByte(groups[1], mode) >= 0:
+			param := nextArg()
+			if adding {
+				state.Modes[mode] = param
+			} else {
+				delete(state.Modes, mode)
+			}
+		case strings.IndexByte(groups[2], mode) >= 0:
+			if adding {
+				state.Modes[mode] = nextArg()
+			} else {
+				delete(state.Modes, mode)
+			}
+		default:
+			if adding {
+				state.Modes[mode] = ""
+			} else {
+				delete(state.Modes, mode)
+			}
+		}
+	}
+}
+
+// Function to split a nick!user@host source into its parts
+func splitSource(source string) (nick, user, host string) {
+	nick, userhost, _ := strings.Cut(source, "!")
+	user, host, _ = strings.Cut(userhost, "@")
+	return nick, user, host
+}
+
+// Function to parse a unix timestamp sent by the server
+func parseUnixTime(value string) time.Time {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
+
+// Function to handle RPL_NAMREPLY: <me> <symbol> <channel> :<names>
+func handleNamReply(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 3 {
+		connection.Channels.addNames(e.Params[2], strings.Fields(e.Params[3]))
+	}
+}
+
+// Function to handle RPL_ENDOFNAMES: <me> <channel> :End of /NAMES list
+func handleEndOfNames(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 1 {
+		connection.Channels.endNames(e.Params[1])
+	}
+}
+
+// Function to handle RPL_WHOREPLY: <me> <channel> <user> <host> <server> <nick> <flags> :<hops> <realname>
+func handleWhoReply(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 6 {
+		connection.Channels.updateFromWho(e.Params[1], e.Params[5], e.Params[2], e.Params[3], e.Params[6])
+	}
+}
+
+// Function to handle RPL_CHANNELMODEIS: <me> <channel> <modes> [<params>...]
+func handleChannelModeIs(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 2 {
+		connection.Channels.applyModes(e.Params[1], "", e.Params[2], e.Params[3:], true)
+	}
+}
+
+// Function to handle RPL_TOPIC: <me> <channel> :<topic>
+func handleTopicReply(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 2 {
+		connection.Channels.setTopic(e.Params[1], e.Params[2], "", time.Time{})
+	}
+}
+
+// Function to handle RPL_NOTOPIC: <me> <channel> :No topic is set
+func handleNoTopic(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 1 {
+		connection.Channels.setTopic(e.Params[1], "", "", time.Time{})
+	}
+}
+
+// Function to handle RPL_TOPICWHOTIME: <me> <channel> <setter> <time>
+func handleTopicWhoTime(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 3 {
+		connection.Channels.setTopicWhoTime(e.Params[1], e.Params[2], parseUnixTime(e.Params[3]))
+	}
+}
+
+// Function to handle RPL_BANLIST: <me> <channel> <mask> [<setter> <time>]
+func handleBanList(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 2 {
+		entry := ListEntry{Mask: e.Params[2]}
+		if len(e.Params) > 4 {
+			entry.SetBy = e.Params[3]
+			entry.SetAt = parseUnixTime(e.Params[4])
+		}
+		connection.Channels.addListEntry(e.Params[1], 'b', entry)
+	}
+}
+
+// Function to handle RPL_ENDOFBANLIST: <me> <channel> :End of channel ban list
+func handleEndOfBanList(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 1 {
+		connection.Channels.endList(e.Params[1], 'b')
+	}
+}
+
+// Function to request the modes, ban list and member details of a channel the bot just joined
+func requestChannelState(connection *Connection, channel string) {
+	connection.Send("MODE", channel)
+	connection.Send("MODE", channel, "b")
+	requestChannelWho(connection, channel)
+}
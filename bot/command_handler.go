@@ -4,16 +4,15 @@ import (
 	"fmt"
 	"mbot/config"
 	"strings"
+	"sync"
 
-	"github.com/ergochat/irc-go/ircevent"
+	"github.com/fatih/color"
 )
 
 var rateLimiter = NewRateLimiter()
-var ConfigData *config.Config
-var CommandConfigData *config.CommandConfig
 
 // CommandHandler is a type alias for functions that handle commands
-type CommandHandler func(connection *ircevent.Connection, sender, target, message string, users map[string]User)
+type CommandHandler func(connection *Connection, sender, target, message string, users map[string]User)
 
 // Command struct to hold the handler, required role, and group/allowed channels
 type Command struct {
@@ -22,45 +21,61 @@ type Command struct {
 	RequiredRole    string
 }
 
-// Map of commands to their handlers and required roles
-var commands = map[string]Command{}
+// Commands the owner can also send by private message, such as answers to queued invites
+// or a !join with a key that should not be shown in a channel
+var privateCommands = map[string]bool{
+	"!invites": true,
+	"!join":    true,
+}
+
+// Map of commands to their handlers, shared by all networks
+var commandHandlers = map[string]CommandHandler{}
+var commandHandlersMu sync.Mutex
 
 // RegisterCommand registers a command with the bot
 func RegisterCommand(cmd string, handler CommandHandler) {
-	if permissions, exists := CommandConfigData.Commands[cmd]; exists {
-		for _, perm := range permissions {
-			commands[cmd] = Command{
-				Handler:         handler,
-				AllowedChannels: perm.Channels,
-				RequiredRole:    perm.Role,
-			}
-		}
-	}
+	commandHandlersMu.Lock()
+	defer commandHandlersMu.Unlock()
+	commandHandlers[cmd] = handler
 }
 
-// ReloadCommandConfig reloads the command configuration from the file
-func ReloadCommandConfig(configPath string) error {
-	cmdCfg, err := config.LoadCommandConfig(configPath)
-	if err != nil {
-		return err
+// lookupCommand combines a registered handler with the permissions a network has configured for it
+func lookupCommand(cmdCfg *config.CommandConfig, cmd, channel string) (Command, bool) {
+	commandHandlersMu.Lock()
+	handler, exists := commandHandlers[cmd]
+	commandHandlersMu.Unlock()
+	if !exists {
+		return Command{}, false
+	}
+
+	permissions, exists := cmdCfg.Commands[cmd]
+	if !exists || len(permissions) == 0 {
+		return Command{}, false
 	}
-	CommandConfigData = cmdCfg
 
-	// Re-register commands to reflect updated permissions
-	for cmd, command := range commands {
-		if handler := command.Handler; handler != nil {
-			RegisterCommand(cmd, handler)
+	// Prefer the permission entry that covers this channel
+	perm := permissions[len(permissions)-1]
+	for _, p := range permissions {
+		for _, allowedChannel := range p.Channels {
+			if allowedChannel == channel {
+				perm = p
+			}
 		}
 	}
-	return nil
+
+	return Command{
+		Handler:         handler,
+		AllowedChannels: perm.Channels,
+		RequiredRole:    perm.Role,
+	}, true
 }
 
-func handleCommand(connection *ircevent.Connection, sender, target, message string, users map[string]User) {
-	// Reload the command configuration
-	err := ReloadCommandConfig("./data/command_permissions.json")
+func handleCommand(connection *Connection, sender, target, message string, users map[string]User) {
+	// Reload the command configuration, the previous one stays in use when the file has problems
+	err := connection.Network.ReloadCommandConfig()
 	if err != nil {
-		connection.Privmsg(target, fmt.Sprintf("Failed to reload command configuration: %v", err))
-		return
+		color.Red(">> Failed to reload command configuration:\n%v", err)
+		connection.Privmsg(target, fmt.Sprintf("Failed to reload command configuration: %s", config.Summary(err)))
 	}
 
 	trimmedMessage := strings.TrimSpace(message)
@@ -70,10 +85,9 @@ func handleCommand(connection *ircevent.Connection, sender, target, message stri
 		return
 	}
 	cmd := parts[0]
-	if command, exists := commands[cmd]; exists {
+	if command, exists := lookupCommand(connection.Network.CommandConfig(), cmd, target); exists {
 		nickname := ExtractNickname(sender)
-		hostmask := ExtractHostmask(sender)
-		userRoleLevel := GetUserRoleLevel(users, hostmask, target)
+		userRoleLevel := GetUserRoleLevelByAccount(users, connection.Accounts.Get(nickname), sender, target)
 
 		if !rateLimiter.AllowCommand(nickname) {
 			if remaining := rateLimiter.GetCooldownRemaining(nickname); remaining > 0 {
@@ -115,3 +129,25 @@ func handleCommand(connection *ircevent.Connection, sender, target, message stri
 		}
 	}
 }
+
+// handlePrivateCommand runs a command sent by private message, reporting whether it was one.
+// Only owners can use them, and only the commands in privateCommands.
+func handlePrivateCommand(connection *Connection, sender, message string, users map[string]User) bool {
+	parts := strings.Fields(message)
+	if len(parts) == 0 || !privateCommands[parts[0]] {
+		return false
+	}
+	nickname := ExtractNickname(sender)
+	if GetUserRoleLevelByAccount(users, connection.Accounts.Get(nickname), sender, "*") < RoleOwner {
+		return false
+	}
+
+	commandHandlersMu.Lock()
+	handler, exists := commandHandlers[parts[0]]
+	commandHandlersMu.Unlock()
+	if !exists {
+		return false
+	}
+	handler(connection, sender, nickname, strings.TrimSpace(message), users)
+	return true
+}
@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"x * * * *",
+		"* * * foo *",
+		"@every",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", utc(2024, 6, 3, 10, 7), utc(2024, 6, 3, 10, 8)},
+		{"strictly after", "0 9 * * *", utc(2024, 6, 3, 9, 0), utc(2024, 6, 4, 9, 0)},
+		{"seconds are dropped", "0 9 * * *", utc(2024, 6, 3, 8, 59).Add(30 * time.Second), utc(2024, 6, 3, 9, 0)},
+		{"list", "0,30 * * * *", utc(2024, 6, 3, 10, 7), utc(2024, 6, 3, 10, 30)},
+		{"step", "*/15 * * * *", utc(2024, 6, 3, 10, 7), utc(2024, 6, 3, 10, 15)},
+		{"step from a start", "5/20 * * * *", utc(2024, 6, 3, 10, 26), utc(2024, 6, 3, 10, 45)},
+		{"step in a range", "0 9-17/4 * * *", utc(2024, 6, 3, 10, 0), utc(2024, 6, 3, 13, 0)},
+		{"range wraps to the next day", "0 9-17/4 * * *", utc(2024, 6, 3, 17, 0), utc(2024, 6, 4, 9, 0)},
+		{"day of month", "0 0 1 * *", utc(2024, 1, 15, 0, 0), utc(2024, 2, 1, 0, 0)},
+		{"day of week names", "30 8 * * mon-fri", utc(2024, 6, 1, 10, 0), utc(2024, 6, 3, 8, 30)},
+		{"sunday as 7", "0 12 * * 7", utc(2024, 6, 1, 0, 0), utc(2024, 6, 2, 12, 0)},
+		{"sunday as 0", "0 12 * * 0", utc(2024, 6, 1, 0, 0), utc(2024, 6, 2, 12, 0)},
+		{"month names", "0 0 1 jan,jul *", utc(2024, 2, 10, 0, 0), utc(2024, 7, 1, 0, 0)},
+		{"month names ignore case", "0 0 1 JAN *", utc(2024, 2, 10, 0, 0), utc(2025, 1, 1, 0, 0)},
+		{"day of month or week, the 13th first", "0 9 13 * fri", utc(2024, 11, 9, 0, 0), utc(2024, 11, 13, 9, 0)},
+		{"day of month or week, the friday first", "0 9 13 * fri", utc(2024, 11, 14, 0, 0), utc(2024, 11, 15, 9, 0)},
+		{"leap day", "0 0 29 2 *", utc(2025, 3, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", utc(2024, 1, 1, 0, 0), time.Time{}},
+		{"31st skips short months", "0 0 31 * *", utc(2024, 4, 1, 0, 0), utc(2024, 5, 31, 0, 0)},
+		{"end of year", "0 0 * * *", utc(2024, 12, 31, 12, 0), utc(2025, 1, 1, 0, 0)},
+		{"daily macro", "@daily", utc(2024, 6, 3, 10, 0), utc(2024, 6, 4, 0, 0)},
+		{"weekly macro", "@weekly", utc(2024, 6, 5, 10, 0), utc(2024, 6, 9, 0, 0)},
+		{"hourly macro", "@hourly", utc(2024, 6, 3, 10, 0), utc(2024, 6, 3, 11, 0)},
+		{"yearly macro", "@yearly", utc(2024, 6, 3, 10, 0), utc(2025, 1, 1, 0, 0)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := ParseCron(test.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", test.expr, err)
+			}
+			if got := schedule.Next(test.from); !got.Equal(test.want) {
+				t.Errorf("Next(%v) = %v, want %v", test.from, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, berlin)
+	}
+	// 2024-03-31 02:00 CET jumps to 03:00 CEST, 2024-10-27 03:00 CEST goes back to 02:00 CET
+	fallBack := time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC).In(berlin) // 02:00 CET, an hour after 02:00 CEST
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"same wall time across spring forward", "0 9 * * *", local(2024, 3, 30, 10, 0), local(2024, 3, 31, 9, 0)},
+		{"skipped time does not run that day", "30 2 * * *", local(2024, 3, 30, 12, 0), local(2024, 4, 1, 2, 30)},
+		{"hour after the gap", "0 3 * * *", local(2024, 3, 31, 0, 0), local(2024, 3, 31, 3, 0)},
+		{"same wall time across fall back", "0 9 * * *", local(2024, 10, 26, 10, 0), local(2024, 10, 27, 9, 0)},
+		{"repeated time runs the first time", "30 2 * * *", local(2024, 10, 27, 0, 0), fallBack.Add(-30 * time.Minute)},
+		{"repeated time does not run again", "30 2 * * *", fallBack.Add(-30 * time.Minute), local(2024, 10, 28, 2, 30)},
+		{"hourly runs in both repeated hours", "0 * * * *", fallBack.Add(-time.Minute), fallBack},
+		{"next hour after the repeat", "0 * * * *", fallBack, fallBack.Add(time.Hour)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := ParseCron(test.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", test.expr, err)
+			}
+			if got := schedule.Next(test.from); !got.Equal(test.want) {
+				t.Errorf("Next(%v) = %v, want %v", test.from, got, test.want)
+			}
+		})
+	}
+}
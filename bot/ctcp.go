@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const (
+	ctcpDelimiter = "\x01"
+	sourceURL     = "https://github.com/mathisen99/Mbot"
+
+	// Replies of each type allowed per window, shared by everyone asking
+	ctcpRepliesPerWindow = 3
+	ctcpWindow           = 10 * time.Second
+)
+
+// ctcpCommands lists the CTCP queries the bot understands, for CLIENTINFO
+var ctcpCommands = []string{"ACTION", "CLIENTINFO", "PING", "SOURCE", "TIME", "VERSION"}
+
+// parseCTCP splits a CTCP message into its command and arguments
+func parseCTCP(message string) (command, args string, ok bool) {
+	if !strings.HasPrefix(message, ctcpDelimiter) {
+		return "", "", false
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(message, ctcpDelimiter), ctcpDelimiter)
+	command, args, _ = strings.Cut(body, " ")
+	if command == "" {
+		return "", "", false
+	}
+	return strings.ToUpper(command), args, true
+}
+
+// ctcpLimiter rate limits CTCP replies with a separate budget for every reply type,
+// so a flood of one query cannot get the bot disconnected or starve the others
+type ctcpLimiter struct {
+	mu      sync.Mutex
+	replies map[string][]time.Time
+}
+
+// newCTCPLimiter creates an empty CTCP reply limiter
+func newCTCPLimiter() *ctcpLimiter {
+	return &ctcpLimiter{replies: make(map[string][]time.Time)}
+}
+
+// allow reports whether another reply of a type may be sent now
+func (l *ctcpLimiter) allow(command string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	recent := l.replies[command][:0]
+	for _, sent := range l.replies[command] {
+		if now.Sub(sent) < ctcpWindow {
+			recent = append(recent, sent)
+		}
+	}
+	if len(recent) >= ctcpRepliesPerWindow {
+		l.replies[command] = recent
+		return false
+	}
+	l.replies[command] = append(recent, now)
+	return true
+}
+
+// Version describes the build, for CTCP VERSION replies and the version subcommand
+func Version() string {
+	version := "(devel)"
+	revision := ""
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Version != "" {
+			version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+				revision = " " + setting.Value[:7]
+			}
+		}
+	}
+	return fmt.Sprintf("Mbot %s%s (%s, %s/%s)", version, revision, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// Function to answer a CTCP query sent to the bot
+func handleCTCPQuery(connection *Connection, sender, command, args string) {
+	nickname := ExtractNickname(sender)
+	color.Magenta(">> CTCP %s from %s", command, sender)
+
+	var reply string
+	switch command {
+	case "VERSION":
+		reply = Version()
+	case "PING":
+		reply = args
+	case "TIME":
+		reply = time.Now().Format(time.RFC1123Z)
+	case "SOURCE":
+		reply = sourceURL
+	case "CLIENTINFO":
+		reply = strings.Join(ctcpCommands, " ")
+	default:
+		return
+	}
+
+	if !connection.ctcp.allow(command) {
+		color.Yellow(">> Ignoring CTCP %s from %s, too many requests", command, sender)
+		return
+	}
+
+	if reply == "" {
+		connection.Notice(nickname, ctcpDelimiter+command+ctcpDelimiter)
+		return
+	}
+	connection.Notice(nickname, ctcpDelimiter+command+" "+reply+ctcpDelimiter)
+}
@@ -1,39 +1,57 @@
 package bot
 
 import (
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/ergochat/irc-go/ircmsg"
 	"github.com/fatih/color"
 )
 
-var once sync.Once
-
 // Function to register event handlers
 func RegisterEventHandlers(connection *Connection, users map[string]User) {
-	once.Do(func() {
-		eventHandlers := map[string]func(*Connection, ircmsg.Message, map[string]User){
-			"PRIVMSG": handlePrivmsg,
-			"NOTICE":  handleNotice,
-			"JOIN":    handleJoin,
-			"PART":    handlePart,
-			"QUIT":    handleQuit,
-			"KICK":    handleKick,
-			"BAN":     handleBan,
-			"MODE":    handleMode,
-			"NICK":    handleNick,
-			"TOPIC":   handleTopic,
-			"INVITE":  handleInvite,
-			"ERROR":   handleError,
-			"PING":    handlePing,
-		}
+	eventHandlers := map[string]func(*Connection, ircmsg.Message, map[string]User){
+		"PRIVMSG": handlePrivmsg,
+		"NOTICE":  handleNotice,
+		"JOIN":    handleJoin,
+		"PART":    handlePart,
+		"QUIT":    handleQuit,
+		"KICK":    handleKick,
+		"BAN":     handleBan,
+		"MODE":    handleMode,
+		"NICK":    handleNick,
+		"TOPIC":   handleTopic,
+		"INVITE":  handleInvite,
+		"ERROR":   handleError,
+		"PING":    handlePing,
+		"ACCOUNT": handleAccount,
+		"CHGHOST": handleChghost,
 
-		for event, handler := range eventHandlers {
-			connection.AddCallback(event, func(e ircmsg.Message) {
-				handler(connection, e, users)
-			})
-		}
-	})
+		replyCodes["RPL_WELCOME"]:       handleWelcome,
+		replyCodes["RPL_HOSTHIDDEN"]:    handleHostHidden,
+		replyCodes["RPL_WHOSPCRPL"]:     handleWhoxReply,
+		replyCodes["RPL_WHOREPLY"]:      handleWhoReply,
+		replyCodes["RPL_NAMREPLY"]:      handleNamReply,
+		replyCodes["RPL_ENDOFNAMES"]:    handleEndOfNames,
+		replyCodes["RPL_CHANNELMODEIS"]: handleChannelModeIs,
+		replyCodes["RPL_TOPIC"]:         handleTopicReply,
+		replyCodes["RPL_NOTOPIC"]:       handleNoTopic,
+		replyCodes["RPL_TOPICWHOTIME"]:  handleTopicWhoTime,
+		replyCodes["RPL_BANLIST"]:       handleBanList,
+		replyCodes["RPL_ENDOFBANLIST"]:  handleEndOfBanList,
+
+		replyCodes["ERR_BANNEDFROMCHAN"]: handleBannedFromChan,
+		replyCodes["ERR_INVITEONLYCHAN"]: handleInviteOnlyChan,
+		replyCodes["ERR_CHANNELISFULL"]:  handleChannelIsFull,
+		replyCodes["ERR_BADCHANNELKEY"]:  handleBadChannelKey,
+	}
+
+	for event, handler := range eventHandlers {
+		connection.AddCallback(event, func(e ircmsg.Message) {
+			connection.Accounts.observe(e)
+			handler(connection, e, users)
+		})
+	}
 }
 
 // Function to extract the sender from an IRC message
@@ -41,22 +59,65 @@ func getSender(e ircmsg.Message) string {
 	return e.Source
 }
 
+// Function to get an optional parameter, such as a part or kick reason
+func lastParam(e ircmsg.Message, index int) string {
+	if len(e.Params) > index {
+		return e.Params[index]
+	}
+	return ""
+}
+
+// Function to check if a source or nick belongs to the bot itself
+func isOwnNick(connection *Connection, source string) bool {
+	return strings.EqualFold(ExtractNickname(source), connection.CurrentNick())
+}
+
 // Function to handle PRIVMSG events (channel and private messages)
 func handlePrivmsg(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
 	target := e.Params[0]
 	message := e.Params[1]
+	isChannel := target[0] == '#' || target[0] == '&'
+
+	if isChannel {
+		if command, args, isCTCP := parseCTCP(message); !isCTCP {
+			connection.logEvent(target, e, LogPrivmsg, "", message)
+			connection.recordSeen(sender, target, SeenMessage, message, "", messageTime(e))
+		} else if command == "ACTION" {
+			connection.logEvent(target, e, LogAction, "", args)
+			connection.recordSeen(sender, target, SeenAction, args, "", messageTime(e))
+		}
+	}
 
-	if target[0] == '#' || target[0] == '&' {
+	if command, args, isCTCP := parseCTCP(message); isCTCP {
+		switch {
+		case command == "ACTION" && isChannel:
+			handleChannelAction(connection, sender, target, args, users)
+		case command == "ACTION":
+			color.Magenta(">> * %s %s", ExtractNickname(sender), args)
+		case !isChannel:
+			handleCTCPQuery(connection, sender, command, args)
+		}
+		return
+	}
+
+	if isChannel {
 		handleChannelMessage(connection, sender, target, message, users)
 	} else {
 		handlePrivateMessage(connection, sender, message)
 	}
 }
 
-// Function to handle private messages
+// Function to handle notices, including CTCP replies
 func handleNotice(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
+	if connection.Channels.IsChannel(e.Params[0]) {
+		connection.logEvent(e.Params[0], e, LogNotice, "", e.Params[1])
+	}
+	if command, args, isCTCP := parseCTCP(e.Params[1]); isCTCP {
+		color.Yellow(">> CTCP %s reply from %s: %s", command, sender, args)
+		return
+	}
 	color.Yellow(">> Notice from %s: %s", sender, e.Params[1])
 }
 
@@ -64,24 +125,66 @@ func handleNotice(connection *Connection, e ircmsg.Message, users map[string]Use
 func handleJoin(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
 	color.Green(">> %s joined %s", sender, e.Params[0])
+
+	// extended-join: JOIN <channel> <account> :<realname>
+	if len(e.Params) > 2 {
+		connection.Accounts.Set(e.Nick(), e.Params[1])
+	}
+
+	connection.Channels.join(e.Params[0], sender)
+	connection.logEvent(e.Params[0], e, LogJoin, "", "")
+	connection.recordSeen(sender, e.Params[0], SeenJoin, "", "", messageTime(e))
+	if isOwnNick(connection, sender) {
+		_, userHost, _ := strings.Cut(sender, "!")
+		connection.setOwnUserHost(userHost)
+		connection.Supervisor.trackJoin(e.Params[0])
+		connection.Rejoin.joined(e.Params[0])
+		requestChannelState(connection, e.Params[0])
+		return
+	}
+
+	connection.Protection.CheckJoinPart(e.Params[0], sender, users)
+	applyJoinPolicy(connection, e.Params[0], sender, connection.Accounts.Get(e.Nick()), users)
+	deliverMemos(connection, sender, e.Params[0])
 }
 
 // Function to handle channel messages
 func handlePart(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
 	color.Red(">> %s parted %s", sender, e.Params[0])
+	connection.logEvent(e.Params[0], e, LogPart, "", lastParam(e, 1))
+	connection.recordSeen(sender, e.Params[0], SeenPart, lastParam(e, 1), "", messageTime(e))
+	connection.Channels.part(e.Params[0], e.Nick())
+
+	if isOwnNick(connection, sender) {
+		connection.Supervisor.trackPart(e.Params[0])
+		return
+	}
+	connection.Protection.CheckJoinPart(e.Params[0], sender, users)
 }
 
 // Function to handle channel messages
 func handleQuit(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
 	color.Magenta(">> %s quit", sender)
+	connection.logEventEverywhere(e.Nick(), e, LogQuit, "", lastParam(e, 0))
+	connection.recordSeen(sender, "", SeenQuit, lastParam(e, 0), "", messageTime(e))
+	connection.Accounts.Remove(e.Nick())
+	connection.Channels.quit(e.Nick())
 }
 
 // Function to handle channel messages
 func handleKick(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
-	color.Red(">> %s was kicked from %s by %s: %s", e.Params[1], e.Params[0], sender, e.Params[2])
+	color.Red(">> %s was kicked from %s by %s: %s", e.Params[1], e.Params[0], sender, lastParam(e, 2))
+	connection.logEvent(e.Params[0], e, LogKick, e.Params[1], lastParam(e, 2))
+	connection.recordSeen(e.Params[1], e.Params[0], SeenKick, lastParam(e, 2), "", messageTime(e))
+	connection.Channels.part(e.Params[0], e.Params[1])
+
+	if isOwnNick(connection, e.Params[1]) {
+		connection.Supervisor.trackPart(e.Params[0])
+		connection.Rejoin.kicked(e.Params[0], sender, lastParam(e, 2))
+	}
 }
 
 // Function to handle channel messages
@@ -93,31 +196,82 @@ func handleBan(connection *Connection, e ircmsg.Message, users map[string]User)
 // Function to handle channel messages
 func handleMode(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
-	color.Blue(">> %s set mode %s on %s", sender, e.Params[1], e.Params[0])
+	color.Blue(">> %s set mode %s on %s", sender, strings.Join(e.Params[1:], " "), e.Params[0])
+
+	if len(e.Params) > 1 && connection.Channels.IsChannel(e.Params[0]) {
+		connection.logEvent(e.Params[0], e, LogMode, "", strings.Join(e.Params[1:], " "))
+		connection.Channels.applyModes(e.Params[0], e.Nick(), e.Params[1], e.Params[2:], false)
+	}
 }
 
 // Function to handle channel messages
 func handleNick(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
 	color.Cyan(">> %s is now known as %s", sender, e.Params[0])
+	connection.logEventEverywhere(e.Nick(), e, LogNick, e.Params[0], "")
+	connection.recordSeen(sender, "", SeenNick, "", e.Params[0], messageTime(e))
+	connection.Accounts.Rename(e.Nick(), e.Params[0])
+	connection.Channels.rename(e.Nick(), e.Params[0])
 }
 
 // Function to handle channel messages
 func handleTopic(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
 	color.Blue(">> %s changed topic on %s to: %s", sender, e.Params[0], e.Params[1])
+	connection.logEvent(e.Params[0], e, LogTopic, "", e.Params[1])
+	connection.Channels.setTopic(e.Params[0], e.Params[1], e.Nick(), time.Now())
 }
 
 // Function to handle channel messages
 func handleInvite(connection *Connection, e ircmsg.Message, users map[string]User) {
 	sender := getSender(e)
 	color.Green(">> %s invited %s to %s", sender, e.Params[0], e.Params[1])
+
+	// With invite-notify the bot also hears about invites of other users
+	if !isOwnNick(connection, e.Params[0]) {
+		return
+	}
+	// Invites to channels the bot is getting back into, usually from ChanServ, are followed right away
+	if connection.Rejoin.Pending(e.Params[1]) {
+		connection.Join(e.Params[1])
+		return
+	}
+	handleInvitePolicy(connection, sender, e.Params[1], users)
+}
+
+// Function to handle joins refused because the bot is banned
+func handleBannedFromChan(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 1 {
+		connection.Rejoin.refused(e.Params[1], IncidentBanned)
+	}
+}
+
+// Function to handle joins refused because the channel is invite only
+func handleInviteOnlyChan(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 1 {
+		connection.Rejoin.refused(e.Params[1], IncidentInviteOnly)
+	}
+}
+
+// Function to handle joins refused because the channel is full
+func handleChannelIsFull(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 1 {
+		connection.Rejoin.refused(e.Params[1], IncidentFull)
+	}
+}
+
+// Function to handle joins refused because of a wrong or missing channel key
+func handleBadChannelKey(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 1 {
+		connection.Rejoin.refused(e.Params[1], IncidentBadKey)
+	}
 }
 
 // Function to handle channel messages
 func handleError(connection *Connection, e ircmsg.Message, users map[string]User) {
 	if len(e.Params) > 0 {
 		color.Red(">> ERROR: %s", e.Params[0])
+		connection.Supervisor.recordError(e.Params[0])
 	}
 }
 
@@ -126,3 +280,35 @@ func handlePing(connection *Connection, e ircmsg.Message, users map[string]User)
 	color.Green(">> Received PING, sending PONG")
 	connection.Send("PONG", e.Params[0])
 }
+
+// Function to handle the welcome message, which usually ends with the bot's full nick!user@host
+func handleWelcome(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) < 2 {
+		return
+	}
+	words := strings.Fields(e.Params[len(e.Params)-1])
+	if len(words) == 0 {
+		return
+	}
+	if _, userHost, found := strings.Cut(words[len(words)-1], "!"); found {
+		connection.setOwnUserHost(userHost)
+	}
+}
+
+// Function to handle RPL_HOSTHIDDEN: <me> <host> :is now your displayed host
+func handleHostHidden(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) > 1 {
+		connection.setOwnHost(e.Params[1])
+	}
+}
+
+// Function to handle CHGHOST: a user's username or host changed
+func handleChghost(connection *Connection, e ircmsg.Message, users map[string]User) {
+	if len(e.Params) < 2 {
+		return
+	}
+	if isOwnNick(connection, e.Source) {
+		connection.setOwnUserHost(e.Params[0] + "@" + e.Params[1])
+	}
+	connection.Channels.changeHost(e.Nick(), e.Params[0], e.Params[1])
+}
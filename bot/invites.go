@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Invite queue limits
+const (
+	maxPendingInvites = 20
+	inviteExpiry      = 24 * time.Hour
+)
+
+// Invites.Others values
+const (
+	InvitesQueue  = "queue"
+	InvitesIgnore = "ignore"
+)
+
+// PendingInvite is an invite waiting for the owner to accept or reject it
+type PendingInvite struct {
+	Channel string
+	From    string // nick!user@host of the inviter
+	Account string
+	At      time.Time
+}
+
+// inviteQueue holds the invites of one connection that were not accepted right away
+type inviteQueue struct {
+	mu      sync.Mutex
+	invites map[string]PendingInvite // lowercase channel -> invite
+}
+
+func newInviteQueue() *inviteQueue {
+	return &inviteQueue{invites: make(map[string]PendingInvite)}
+}
+
+// add queues an invite, reporting whether it is new. A repeated invite to the same channel replaces the old one.
+func (q *inviteQueue) add(invite PendingInvite) (added bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	key := strings.ToLower(invite.Channel)
+	_, exists := q.invites[key]
+	if !exists && len(q.invites) >= maxPendingInvites {
+		return false
+	}
+	q.invites[key] = invite
+	return !exists
+}
+
+// take removes and returns the invite to a channel
+func (q *inviteQueue) take(channel string) (PendingInvite, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	key := strings.ToLower(channel)
+	invite, exists := q.invites[key]
+	delete(q.invites, key)
+	return invite, exists
+}
+
+// list returns the pending invites, oldest first
+func (q *inviteQueue) list() []PendingInvite {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.expire()
+	invites := make([]PendingInvite, 0, len(q.invites))
+	for _, invite := range q.invites {
+		invites = append(invites, invite)
+	}
+	sort.Slice(invites, func(i, j int) bool { return invites[i].At.Before(invites[j].At) })
+	return invites
+}
+
+// expire drops invites older than a day. The caller holds the lock.
+func (q *inviteQueue) expire() {
+	for key, invite := range q.invites {
+		if time.Since(invite.At) > inviteExpiry {
+			delete(q.invites, key)
+		}
+	}
+}
+
+// PendingInvites returns the invites waiting for the owner
+func (c *Connection) PendingInvites() []PendingInvite {
+	return c.invites.list()
+}
+
+// AcceptInvite joins the channel of a pending invite and saves it to the runtime channel list
+func (c *Connection) AcceptInvite(channel, acceptedBy string) (PendingInvite, bool) {
+	invite, exists := c.invites.take(channel)
+	if exists {
+		c.joinInvited(invite.Channel, ExtractNickname(invite.From)+" (accepted by "+acceptedBy+")")
+	}
+	return invite, exists
+}
+
+// RejectInvite drops a pending invite
+func (c *Connection) RejectInvite(channel string) (PendingInvite, bool) {
+	return c.invites.take(channel)
+}
+
+// joinInvited joins a channel the bot was invited to and remembers it across restarts
+func (c *Connection) joinInvited(channel, addedBy string) {
+	err := c.Network.Joined.Add(JoinedChannel{
+		Network:   c.Network.Name,
+		Name:      channel,
+		AddedBy:   addedBy,
+		AddedAt:   time.Now(),
+		ViaInvite: true,
+	})
+	if err != nil {
+		color.Red(">> Error saving the channel list: %v", err)
+	}
+	c.Join(channel)
+}
+
+// handleInvitePolicy decides what to do with an invite of the bot to a channel
+func handleInvitePolicy(connection *Connection, source, channel string, users map[string]User) {
+	if connection.Channels.IsOn(channel, connection.CurrentNick()) {
+		return
+	}
+	nick := ExtractNickname(source)
+	account := connection.Accounts.Get(nick)
+	policy := connection.Config.Invites
+
+	acceptRole := policy.AcceptRole
+	if _, valid := UserRoles[acceptRole]; !valid {
+		acceptRole = "Admin"
+	}
+	if GetUserRoleLevelByAccount(users, account, source, channel) >= UserRoles[acceptRole] {
+		color.Green(">> Accepting invite to %s from %s", channel, nick)
+		connection.joinInvited(channel, nick)
+		return
+	}
+
+	if !policy.AllowChannelOps {
+		queueInvite(connection, source, account, channel)
+		return
+	}
+
+	// The bot is not in the channel, so the inviter's status there comes from their WHOIS channel list
+	connection.Whois(nick, func(result WhoisResult) {
+		for _, entry := range result.Channels {
+			name := strings.TrimLeft(entry, "~&@%+")
+			if strings.EqualFold(name, channel) && strings.ContainsAny(entry[:len(entry)-len(name)], "~&@") {
+				color.Green(">> Accepting invite to %s from channel operator %s", channel, nick)
+				connection.joinInvited(channel, nick)
+				return
+			}
+		}
+		queueInvite(connection, source, account, channel)
+	})
+}
+
+// queueInvite holds an invite for the owner, or drops it when the policy says to ignore others
+func queueInvite(connection *Connection, source, account, channel string) {
+	if connection.Config.Invites.Others == InvitesIgnore {
+		color.Yellow(">> Ignoring invite to %s from %s", channel, source)
+		return
+	}
+	invite := PendingInvite{Channel: channel, From: source, Account: account, At: time.Now()}
+	if !connection.invites.add(invite) {
+		color.Yellow(">> Not queueing invite to %s from %s, it is already pending or the queue is full", channel, source)
+		return
+	}
+	color.Yellow(">> Queued invite to %s from %s for the owner", channel, source)
+	connection.NotifyOwners(fmt.Sprintf("%s invited me to %s. Reply with !invites accept %s or !invites reject %s.", source, channel, channel, channel))
+}
+
+// NotifyOwners sends a private message to every owner in the bot's channels.
+// When none of them is around it is left as a private memo for the owners logged in to an account.
+func (c *Connection) NotifyOwners(text string) {
+	users := c.Network.Users
+	notified := make(map[string]bool)
+	for _, channel := range c.Channels.Names() {
+		for _, member := range c.Channels.Members(channel) {
+			key := strings.ToLower(member.Nick)
+			if notified[key] || isOwnNick(c, member.Nick) {
+				continue
+			}
+			if GetUserRoleLevelByAccount(users, member.Account, member.Hostmask(), "*") == RoleOwner {
+				notified[key] = true
+				c.SendLong(member.Nick, text)
+			}
+		}
+	}
+	if len(notified) > 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, user := range users {
+		if user.Roles["*"] != "Owner" || user.Account == "" {
+			continue
+		}
+		_, err := c.Network.Memos.Add(Memo{
+			Network:   c.Network.Name,
+			From:      c.CurrentNick(),
+			To:        user.Account,
+			ToAccount: user.Account,
+			Text:      text,
+			Private:   true,
+			CreatedAt: now,
+			ExpiresAt: now.Add(MemoExpiry),
+		})
+		if err != nil {
+			color.Red(">> Error leaving a memo for owner %s: %v", user.Account, err)
+		}
+	}
+}
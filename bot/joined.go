@@ -0,0 +1,99 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JoinedChannel is a channel the bot was asked to join at runtime, by !join or an accepted invite
+type JoinedChannel struct {
+	Network   string    `json:"network"`
+	Name      string    `json:"name"`
+	Key       string    `json:"key,omitempty"`
+	AddedBy   string    `json:"added_by"`
+	AddedAt   time.Time `json:"added_at"`
+	ViaInvite bool      `json:"via_invite,omitempty"`
+}
+
+// JoinedChannels keeps the channels joined at runtime so they are joined again after a restart
+type JoinedChannels struct {
+	mu       sync.Mutex
+	filePath string
+	channels []JoinedChannel
+}
+
+// LoadJoinedChannels loads the runtime channel list from a file
+func LoadJoinedChannels(filePath string) (*JoinedChannels, error) {
+	s := &JoinedChannels{filePath: filePath}
+	if err := loadJSON(filePath, &s.channels); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add stores a channel, or updates it when it is already on the list. A saved key is kept when the new entry has none.
+func (s *JoinedChannels) Add(channel JoinedChannel) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.channels {
+		if existing.Network == channel.Network && strings.EqualFold(existing.Name, channel.Name) {
+			if channel.Key == "" {
+				channel.Key = existing.Key
+			}
+			s.channels[i] = channel
+			return saveJSON(s.filePath, s.channels)
+		}
+	}
+	s.channels = append(s.channels, channel)
+	return saveJSON(s.filePath, s.channels)
+}
+
+// Remove takes a channel off the list, reporting whether it was on it
+func (s *JoinedChannels) Remove(network, channel string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, existing := range s.channels {
+		if existing.Network == network && strings.EqualFold(existing.Name, channel) {
+			s.channels = append(s.channels[:i:i], s.channels[i+1:]...)
+			return true, saveJSON(s.filePath, s.channels)
+		}
+	}
+	return false, nil
+}
+
+// List returns the channels of a network, sorted by name
+func (s *JoinedChannels) List(network string) []JoinedChannel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []JoinedChannel
+	for _, channel := range s.channels {
+		if channel.Network == network {
+			result = append(result, channel)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return strings.ToLower(result[i].Name) < strings.ToLower(result[j].Name) })
+	return result
+}
+
+// Names returns the names of the channels of a network
+func (s *JoinedChannels) Names(network string) []string {
+	var names []string
+	for _, channel := range s.List(network) {
+		names = append(names, channel.Name)
+	}
+	return names
+}
+
+// Key returns the saved key of a channel, or an empty string
+func (s *JoinedChannels) Key(network, channel string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.channels {
+		if existing.Network == network && strings.EqualFold(existing.Name, channel) {
+			return existing.Key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,252 @@
+package bot
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Ways to send the welcome text to first-time joiners
+const (
+	WelcomeNotice  = "notice"
+	WelcomePrivmsg = "privmsg"
+)
+
+// How often changes to the first-time joiners are written to disk, and how many are kept per channel
+// for how long. Joiners not seen for that long get the welcome again.
+const (
+	joinPolicySaveInterval = time.Minute
+	maxKnownJoiners        = 5000
+	knownJoinerExpiry      = 180 * 24 * time.Hour
+)
+
+// JoinPolicy says what the bot does when someone joins a channel.
+// Templates may use {nick}, {channel} and {network}.
+type JoinPolicy struct {
+	OpRole        string            `json:"op_role,omitempty"`    // users with this role or above get +o
+	VoiceRole     string            `json:"voice_role,omitempty"` // users with this role or above get +v
+	DelaySeconds  int               `json:"delay_seconds,omitempty"`
+	Greeting      string            `json:"greeting,omitempty"`       // said in the channel on every join
+	UserGreetings map[string]string `json:"user_greetings,omitempty"` // by users.json key, replaces Greeting
+	Welcome       string            `json:"welcome,omitempty"`        // sent to users joining for the first time
+	WelcomeMethod string            `json:"welcome_method,omitempty"` // notice (default) or privmsg
+	Known         KnownJoiners      `json:"known,omitempty"`          // accounts and user@hosts seen joining
+}
+
+// KnownJoiners maps the accounts and user@hosts that joined a channel to when they last did
+type KnownJoiners map[string]time.Time
+
+// UnmarshalJSON also reads older files, which stored true instead of the time
+func (k *KnownJoiners) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*k = make(KnownJoiners, len(raw))
+	now := time.Now()
+	for identity, value := range raw {
+		var at time.Time
+		if err := json.Unmarshal(value, &at); err != nil {
+			at = now
+		}
+		(*k)[identity] = at
+	}
+	return nil
+}
+
+// prune forgets joiners not seen since the expiry and the oldest ones beyond the limit
+func (k KnownJoiners) prune(now time.Time) {
+	for identity, at := range k {
+		if now.Sub(at) > knownJoinerExpiry {
+			delete(k, identity)
+		}
+	}
+	if len(k) <= maxKnownJoiners {
+		return
+	}
+	identities := make([]string, 0, len(k))
+	for identity := range k {
+		identities = append(identities, identity)
+	}
+	sort.Slice(identities, func(i, j int) bool { return k[identities[i]].Before(k[identities[j]]) })
+	for _, identity := range identities[:len(k)-maxKnownJoiners] {
+		delete(k, identity)
+	}
+}
+
+// JoinPolicies holds the join policies of all channels, stored in a single file
+type JoinPolicies struct {
+	mu       sync.Mutex
+	filePath string
+	channels map[string]*JoinPolicy
+	dirty    bool // first-time joiners changed since the last save
+}
+
+// LoadJoinPolicies loads the join policies from a file, starting empty if it does not exist.
+// Policy changes are saved right away, new first-time joiners every minute.
+func LoadJoinPolicies(filePath string) (*JoinPolicies, error) {
+	p := &JoinPolicies{
+		filePath: filePath,
+		channels: make(map[string]*JoinPolicy),
+	}
+	if err := loadJSON(filePath, &p.channels); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for range time.Tick(joinPolicySaveInterval) {
+			if err := p.Save(); err != nil {
+				color.Red(">> Error saving join policies: %v", err)
+			}
+		}
+	}()
+	return p, nil
+}
+
+// Save writes the join policies to disk if first-time joiners changed
+func (p *JoinPolicies) Save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.dirty {
+		return nil
+	}
+	return p.save()
+}
+
+// save writes the join policies to disk, the lock must be held
+func (p *JoinPolicies) save() error {
+	if err := saveJSON(p.filePath, p.channels); err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
+
+// Get returns a copy of the policy of a channel
+func (p *JoinPolicies) Get(channel string) (JoinPolicy, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	policy, exists := p.channels[strings.ToLower(channel)]
+	if !exists {
+		return JoinPolicy{}, false
+	}
+	return *policy, true
+}
+
+// Update changes the policy of a channel and saves it
+func (p *JoinPolicies) Update(channel string, change func(policy *JoinPolicy)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := strings.ToLower(channel)
+	policy, exists := p.channels[key]
+	if !exists {
+		policy = &JoinPolicy{}
+		p.channels[key] = policy
+	}
+	change(policy)
+	return p.save()
+}
+
+// Remove deletes the policy of a channel and saves the rest
+func (p *JoinPolicies) Remove(channel string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.channels, strings.ToLower(channel))
+	return p.save()
+}
+
+// markKnown remembers an identity joining a channel with a welcome, reporting whether it joined for the
+// first time. The change is saved with the next periodic save.
+func (p *JoinPolicies) markKnown(channel, identity string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	policy, exists := p.channels[strings.ToLower(channel)]
+	if !exists || policy.Welcome == "" {
+		return false
+	}
+	now := time.Now()
+	_, known := policy.Known[identity]
+	if policy.Known == nil {
+		policy.Known = make(KnownJoiners)
+	}
+	policy.Known[identity] = now
+	if !known {
+		policy.Known.prune(now)
+	}
+	p.dirty = true
+	return !known
+}
+
+// FormatGreeting fills in the placeholders of a greeting template
+func FormatGreeting(template, nick, channel, network string) string {
+	return strings.NewReplacer("{nick}", nick, "{channel}", channel, "{network}", network).Replace(template)
+}
+
+// Function to apply the join policy of a channel to someone who just joined it
+func applyJoinPolicy(connection *Connection, channel, source, account string, users map[string]User) {
+	policy, exists := connection.Network.JoinPolicies.Get(channel)
+	if !exists {
+		return
+	}
+
+	nick := ExtractNickname(source)
+	level := GetUserRoleLevelByAccount(users, account, source, channel)
+	if level == RoleBadBoy {
+		return
+	}
+
+	mode := ""
+	if role, ok := UserRoles[policy.OpRole]; ok && policy.OpRole != "" && level >= role {
+		mode = "+o"
+	} else if role, ok := UserRoles[policy.VoiceRole]; ok && policy.VoiceRole != "" && level >= role {
+		mode = "+v"
+	}
+	if mode != "" {
+		delay := time.Duration(policy.DelaySeconds) * time.Second
+		time.AfterFunc(delay, func() { setJoinMode(connection, channel, nick, mode) })
+	}
+
+	// Accounts are stable across hosts, user@host is the best there is without one
+	identity := NormalizeHostmask(ExtractHostmask(source))
+	if account != "" {
+		identity = AccountKeyPrefix + strings.ToLower(account)
+	}
+	if policy.Welcome != "" && connection.Network.JoinPolicies.markKnown(channel, identity) {
+		welcome := FormatGreeting(policy.Welcome, nick, channel, connection.Network.Name)
+		if policy.WelcomeMethod == WelcomePrivmsg {
+			connection.Privmsg(nick, welcome)
+		} else {
+			connection.Notice(nick, welcome)
+		}
+	}
+
+	greeting := policy.Greeting
+	if user, found := FindUser(users, account, source); found {
+		if userGreeting, exists := policy.UserGreetings[user.Key()]; exists {
+			greeting = userGreeting
+		}
+	}
+	if greeting != "" {
+		connection.Privmsg(channel, FormatGreeting(greeting, nick, channel, connection.Network.Name))
+	}
+}
+
+// Function to give a joined user their mode, if they are still there and the bot can
+func setJoinMode(connection *Connection, channel, nick, mode string) {
+	if !connection.Channels.IsOn(channel, nick) {
+		return
+	}
+	if !connection.Channels.IsOp(channel, connection.CurrentNick()) {
+		color.Yellow(">> Cannot set %s on %s in %s, the bot is not an operator", mode, nick, channel)
+		return
+	}
+	if (mode == "+o" && connection.Channels.IsOp(channel, nick)) || (mode == "+v" && connection.Channels.IsVoiced(channel, nick)) {
+		return
+	}
+	color.Green(">> Setting %s on %s in %s", mode, nick, channel)
+	connection.Send("MODE", channel, mode, nick)
+}
@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NormalizeMask validates a nick!user@host mask and fills in a missing nick part
+func NormalizeMask(mask string) (string, error) {
+	if !strings.Contains(mask, "@") {
+		return "", fmt.Errorf("mask %q must look like nick!user@host", mask)
+	}
+	if !strings.Contains(mask, "!") {
+		mask = "*!" + mask
+	}
+	if strings.Index(mask, "!") > strings.Index(mask, "@") {
+		return "", fmt.Errorf("mask %q must look like nick!user@host", mask)
+	}
+	return mask, nil
+}
+
+// MatchesEveryone reports whether a mask is made of nothing but wildcards and separators, such as
+// *!*@* or *!*@*.*, and so matches (nearly) every user
+func MatchesEveryone(mask string) bool {
+	return strings.Trim(mask, "*?!@.") == ""
+}
+
+// MatchMask reports whether s matches a mask using IRC style * and ? wildcards, ignoring case
+func MatchMask(mask, s string) bool {
+	m := []rune(strings.ToLower(mask))
+	t := []rune(strings.ToLower(s))
+
+	// Iterative glob matching that backtracks to the last star
+	mi, ti := 0, 0
+	starMi, starTi := -1, 0
+	for ti < len(t) {
+		switch {
+		case mi < len(m) && (m[mi] == '?' || m[mi] == t[ti]):
+			mi++
+			ti++
+		case mi < len(m) && m[mi] == '*':
+			starMi, starTi = mi, ti
+			mi++
+		case starMi >= 0:
+			mi = starMi + 1
+			starTi++
+			ti = starTi
+		default:
+			return false
+		}
+	}
+	for mi < len(m) && m[mi] == '*' {
+		mi++
+	}
+	return mi == len(m)
+}
+
+// maskSpecificity scores a mask by its number of literal characters, so *!*@host.example
+// beats *!*@*.example and an exact mask beats both
+func maskSpecificity(mask string) int {
+	score := 0
+	for _, r := range mask {
+		if r != '*' && r != '?' {
+			score++
+		}
+	}
+	return score
+}
+
+// sourceToMaskTarget turns a sender into nick!user@host form for mask matching.
+// Plain user@host hostmasks get a * nick, which only matches masks with a * nick.
+func sourceToMaskTarget(source string) string {
+	if strings.Contains(source, "!") {
+		return source
+	}
+	return "*!" + source
+}
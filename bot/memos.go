@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Memo limits
+const (
+	MaxMemosPerRecipient = 10
+	MaxMemosPerSender    = 20
+	MemoExpiry           = 30 * 24 * time.Hour
+)
+
+var (
+	ErrRecipientMailboxFull = errors.New("recipient has too many pending memos")
+	ErrTooManyMemos         = errors.New("sender has too many pending memos")
+)
+
+// Memo is a message left for someone who is not around
+type Memo struct {
+	ID          int       `json:"id"`
+	Network     string    `json:"network"`
+	From        string    `json:"from"`
+	FromAccount string    `json:"from_account,omitempty"`
+	To          string    `json:"to"`
+	ToAccount   string    `json:"to_account,omitempty"` // when set, only this account gets the memo
+	Text        string    `json:"text"`
+	Private     bool      `json:"private,omitempty"` // delivered by PM instead of in the channel
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// memoData is the layout of the memos file
+type memoData struct {
+	NextID int    `json:"next_id"`
+	Memos  []Memo `json:"memos"`
+}
+
+// MemoStore keeps the memos waiting to be delivered
+type MemoStore struct {
+	mu       sync.Mutex
+	filePath string
+	data     memoData
+}
+
+// LoadMemoStore loads the memos from a file
+func LoadMemoStore(filePath string) (*MemoStore, error) {
+	s := &MemoStore{filePath: filePath}
+	if err := loadJSON(filePath, &s.data); err != nil {
+		return nil, err
+	}
+	if s.data.NextID == 0 {
+		s.data.NextID = 1
+	}
+	return s, nil
+}
+
+// Add stores a memo within the per-recipient and per-sender limits and returns its ID
+func (s *MemoStore) Add(memo Memo) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropExpired(time.Now())
+
+	toRecipient, fromSender := 0, 0
+	for _, existing := range s.data.Memos {
+		if existing.Network != memo.Network {
+			continue
+		}
+		if strings.EqualFold(existing.To, memo.To) || (memo.ToAccount != "" && strings.EqualFold(existing.ToAccount, memo.ToAccount)) {
+			toRecipient++
+		}
+		if existing.sentBy(memo.From, memo.FromAccount) {
+			fromSender++
+		}
+	}
+	if toRecipient >= MaxMemosPerRecipient {
+		return 0, ErrRecipientMailboxFull
+	}
+	if fromSender >= MaxMemosPerSender {
+		return 0, ErrTooManyMemos
+	}
+
+	memo.ID = s.data.NextID
+	s.data.NextID++
+	s.data.Memos = append(s.data.Memos, memo)
+	return memo.ID, saveJSON(s.filePath, s.data)
+}
+
+// SentBy returns the pending memos left by a sender
+func (s *MemoStore) SentBy(network, nick, account string) []Memo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropExpired(time.Now())
+
+	var result []Memo
+	for _, memo := range s.data.Memos {
+		if memo.Network == network && memo.sentBy(nick, account) {
+			result = append(result, memo)
+		}
+	}
+	return result
+}
+
+// Cancel removes a pending memo, but only for the one who left it
+func (s *MemoStore) Cancel(network string, id int, nick, account string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, memo := range s.data.Memos {
+		if memo.ID == id && memo.Network == network && memo.sentBy(nick, account) {
+			s.data.Memos = append(s.data.Memos[:i:i], s.data.Memos[i+1:]...)
+			return true, saveJSON(s.filePath, s.data)
+		}
+	}
+	return false, nil
+}
+
+// Take removes and returns the memos for a recipient, matching by account when the memo has one
+func (s *MemoStore) Take(network, nick, account string) ([]Memo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := s.dropExpired(time.Now())
+
+	var taken []Memo
+	remaining := make([]Memo, 0, len(s.data.Memos))
+	for _, memo := range s.data.Memos {
+		if memo.Network == network && memo.isFor(nick, account) {
+			taken = append(taken, memo)
+		} else {
+			remaining = append(remaining, memo)
+		}
+	}
+	if len(taken) == 0 && !dropped {
+		return nil, nil
+	}
+	s.data.Memos = remaining
+	return taken, saveJSON(s.filePath, s.data)
+}
+
+// dropExpired removes expired memos, reporting whether there were any. The caller holds the lock.
+func (s *MemoStore) dropExpired(now time.Time) bool {
+	remaining := make([]Memo, 0, len(s.data.Memos))
+	for _, memo := range s.data.Memos {
+		if now.Before(memo.ExpiresAt) {
+			remaining = append(remaining, memo)
+		}
+	}
+	dropped := len(remaining) != len(s.data.Memos)
+	s.data.Memos = remaining
+	return dropped
+}
+
+// isFor reports whether a memo is addressed to a nick or account
+func (m Memo) isFor(nick, account string) bool {
+	if m.ToAccount != "" {
+		return strings.EqualFold(m.ToAccount, account)
+	}
+	return strings.EqualFold(m.To, nick)
+}
+
+// sentBy reports whether a memo was left by a nick or account
+func (m Memo) sentBy(nick, account string) bool {
+	if m.FromAccount != "" {
+		return strings.EqualFold(m.FromAccount, account)
+	}
+	return strings.EqualFold(m.From, nick)
+}
+
+// Function to deliver the memos waiting for someone who just spoke or joined in a channel
+func deliverMemos(connection *Connection, source, channel string) {
+	nick := ExtractNickname(source)
+	memos, err := connection.Network.Memos.Take(connection.Network.Name, nick, connection.Accounts.Get(nick))
+	if err != nil {
+		color.Red(">> Error saving memos: %v", err)
+	}
+
+	for _, memo := range memos {
+		text := fmt.Sprintf("%s left you a message %s ago: %s", memo.From, FormatRoughDuration(time.Since(memo.CreatedAt)), memo.Text)
+		color.Green(">> Delivering memo %d from %s to %s", memo.ID, memo.From, nick)
+		if memo.Private {
+			connection.Privmsg(nick, text)
+		} else {
+			connection.SendLong(channel, nick+": "+text)
+		}
+	}
+}
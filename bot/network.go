@@ -0,0 +1,269 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"mbot/config"
+
+	"github.com/ergochat/irc-go/ircevent"
+)
+
+// Data file names used inside a network's data directory
+const (
+	UsersFile             = "users.json"
+	CommandConfigFile     = "command_permissions.json"
+	URLConfigFile         = "url_config.json"
+	PersonalitiesFile     = "personalities.json"
+	BansFile              = "bans.json"
+	JoinPoliciesFile      = "join_policies.json"
+	ModerationLogFile     = "moderation.log"
+	IncidentLogFile       = "incidents.log"
+	SeenFile              = "seen.json"
+	MemosFile             = "memos.json"
+	RemindersFile         = "reminders.json"
+	AnnouncementsFile     = "announcements.json"
+	JoinedChannelsFile    = "channels.json"
+	networksDataDirectory = "networks"
+)
+
+// Network ties a connection to its configuration and the data it uses
+type Network struct {
+	Name   string
+	Config *config.Config
+	*NetworkData
+}
+
+// NetworkData holds the users, command permissions, URL settings, personalities, timed bans,
+// join policies, seen records, memos, reminders, announcements and runtime channels loaded from one data directory. Networks with shared_data use the same instance.
+type NetworkData struct {
+	Dir           string
+	Users         map[string]User
+	URLConfig     *config.URLFeatures
+	Personalities *config.Personalities
+	Bans          *BanStore
+	JoinPolicies  *JoinPolicies
+	Seen          *SeenTracker
+	Memos         *MemoStore
+	Reminders     *ReminderStore
+	Announcements *AnnouncementStore
+	Joined        *JoinedChannels
+
+	mu            sync.Mutex
+	commandConfig *config.CommandConfig
+}
+
+// LoadNetworks builds a Network for every network in the config.
+// Networks using shared data get the files in the data directory, the others get their own directory below it.
+func LoadNetworks(cfg *config.Config) ([]*Network, error) {
+	var shared *NetworkData
+	var networks []*Network
+	seen := make(map[string]bool)
+
+	for _, netCfg := range cfg.NetworkConfigs() {
+		if seen[netCfg.Name] {
+			return nil, fmt.Errorf("network %q is defined more than once", netCfg.Name)
+		}
+		seen[netCfg.Name] = true
+
+		var data *NetworkData
+		var err error
+		if netCfg.SharedData {
+			if shared == nil {
+				shared, err = LoadNetworkData(NetworkDataDir(netCfg))
+			}
+			data = shared
+		} else {
+			data, err = LoadNetworkData(NetworkDataDir(netCfg))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("network %s: %w", netCfg.Name, err)
+		}
+
+		networks = append(networks, &Network{Name: netCfg.Name, Config: netCfg, NetworkData: data})
+	}
+
+	return networks, nil
+}
+
+// NetworkDataDir returns the directory a network keeps its data files in
+func NetworkDataDir(netCfg *config.Config) string {
+	if netCfg.SharedData {
+		return DataDir()
+	}
+	return DataPath(networksDataDirectory, netCfg.Name)
+}
+
+// CheckNetworks loads the data files of every network in the config to find errors, without
+// creating the missing ones or changing anything
+func CheckNetworks(cfg *config.Config) error {
+	var errs []error
+	checked := make(map[string]bool)
+	for _, netCfg := range cfg.NetworkConfigs() {
+		dir := NetworkDataDir(netCfg)
+		if checked[dir] {
+			continue
+		}
+		checked[dir] = true
+		if err := CheckNetworkData(dir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckNetworkData loads the data files that exist in a directory and reports the ones that fail to load
+func CheckNetworkData(dir string) error {
+	checks := []struct {
+		file string
+		load func(string) error
+	}{
+		{UsersFile, func(path string) error { _, err := LoadUsers(path); return err }},
+		{CommandConfigFile, func(path string) error { _, err := loadCommandConfig(path); return err }},
+		{URLConfigFile, func(path string) error { _, err := config.LoadURLConfig(path); return err }},
+		{PersonalitiesFile, func(path string) error { _, err := config.LoadPersonalities(path); return err }},
+		{BansFile, func(path string) error { _, err := LoadBanStore(path); return err }},
+		{JoinPoliciesFile, func(path string) error { _, err := LoadJoinPolicies(path); return err }},
+		{SeenFile, func(path string) error { _, err := LoadSeenTracker(path); return err }},
+		{MemosFile, func(path string) error { _, err := LoadMemoStore(path); return err }},
+		{RemindersFile, func(path string) error { _, err := LoadReminderStore(path); return err }},
+		{AnnouncementsFile, func(path string) error { _, err := LoadAnnouncementStore(path); return err }},
+		{JoinedChannelsFile, func(path string) error { _, err := LoadJoinedChannels(path); return err }},
+	}
+
+	var errs []error
+	for _, check := range checks {
+		path := filepath.Join(dir, check.file)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue // created with defaults on the first run
+		}
+		if err := check.load(path); err != nil {
+			var problems config.Problems
+			if !errors.As(err, &problems) {
+				err = fmt.Errorf("%s: %w", path, err) // problems already name the file
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadNetworkData loads all data files from a directory, creating defaults for missing ones
+func LoadNetworkData(dir string) (*NetworkData, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create data directory %s: %w", dir, err)
+	}
+
+	data := &NetworkData{Dir: dir}
+	var err error
+
+	if data.commandConfig, err = loadCommandConfig(data.CommandConfigPath()); err != nil {
+		return nil, err
+	}
+	if data.URLConfig, err = config.LoadURLConfig(data.URLConfigPath()); err != nil {
+		return nil, err
+	}
+	if data.Users, err = LoadUsers(data.UsersPath()); err != nil {
+		return nil, err
+	}
+	if data.Personalities, err = config.LoadPersonalities(filepath.Join(dir, PersonalitiesFile)); err != nil {
+		return nil, err
+	}
+	if data.Bans, err = LoadBanStore(filepath.Join(dir, BansFile)); err != nil {
+		return nil, err
+	}
+	if data.JoinPolicies, err = LoadJoinPolicies(filepath.Join(dir, JoinPoliciesFile)); err != nil {
+		return nil, err
+	}
+	if data.Seen, err = LoadSeenTracker(filepath.Join(dir, SeenFile)); err != nil {
+		return nil, err
+	}
+	if data.Memos, err = LoadMemoStore(filepath.Join(dir, MemosFile)); err != nil {
+		return nil, err
+	}
+	if data.Reminders, err = LoadReminderStore(filepath.Join(dir, RemindersFile)); err != nil {
+		return nil, err
+	}
+	if data.Announcements, err = LoadAnnouncementStore(filepath.Join(dir, AnnouncementsFile)); err != nil {
+		return nil, err
+	}
+	if data.Joined, err = LoadJoinedChannels(filepath.Join(dir, JoinedChannelsFile)); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// loadCommandConfig loads the command permissions and checks their roles
+func loadCommandConfig(filePath string) (*config.CommandConfig, error) {
+	cmdCfg, err := config.LoadCommandConfig(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCommandConfig(cmdCfg, filePath); err != nil {
+		return nil, err
+	}
+	return cmdCfg, nil
+}
+
+// UsersPath returns the path of the users file
+func (d *NetworkData) UsersPath() string {
+	return filepath.Join(d.Dir, UsersFile)
+}
+
+// CommandConfigPath returns the path of the command permissions file
+func (d *NetworkData) CommandConfigPath() string {
+	return filepath.Join(d.Dir, CommandConfigFile)
+}
+
+// URLConfigPath returns the path of the URL features file
+func (d *NetworkData) URLConfigPath() string {
+	return filepath.Join(d.Dir, URLConfigFile)
+}
+
+// ModerationLogPath returns the path of the moderation log
+func (d *NetworkData) ModerationLogPath() string {
+	return filepath.Join(d.Dir, ModerationLogFile)
+}
+
+// IncidentLogPath returns the path of the log of kicks and refused joins of the bot
+func (d *NetworkData) IncidentLogPath() string {
+	return filepath.Join(d.Dir, IncidentLogFile)
+}
+
+// CommandConfig returns the current command permissions
+func (d *NetworkData) CommandConfig() *config.CommandConfig {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.commandConfig
+}
+
+// ReloadCommandConfig reloads the command permissions from disk. The current permissions
+// stay in use when the file has problems.
+func (d *NetworkData) ReloadCommandConfig() error {
+	cmdCfg, err := loadCommandConfig(d.CommandConfigPath())
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.commandConfig = cmdCfg
+	d.mu.Unlock()
+	return nil
+}
+
+// SaveUsers writes the users of this data directory to disk
+func (d *NetworkData) SaveUsers() error {
+	return SaveUsers(d.Users, d.UsersPath())
+}
+
+// GetNetwork returns the network a connection belongs to
+func GetNetwork(irc *ircevent.Connection) *Network {
+	if conn := GetConnection(irc); conn != nil {
+		return conn.Network
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"mbot/config"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+	"github.com/fatih/color"
+)
+
+// Nick recovery settings
+const (
+	NickRecoveryRegain = "regain"
+	NickRecoveryGhost  = "ghost"
+	NickRecoveryNone   = "none"
+
+	defaultNickCheckInterval = time.Minute
+	ghostNickDelay           = 2 * time.Second
+	nickRecoveryCooldown     = 5 * time.Minute
+)
+
+// RPL_MONOFFLINE, sent by MONITOR and not in the replyCodes map
+const rplMonOffline = "731"
+
+// NickManager picks an alternate nick when the configured one is taken and works to get it back,
+// through NickServ when the bot has credentials and by watching for it with MONITOR or ISON
+type NickManager struct {
+	mu            sync.Mutex
+	conn          *Connection
+	primary       string
+	alternates    []string
+	method        string
+	checkInterval time.Duration
+	attempt       int
+	monitoring    bool
+	lastRecovery  time.Time
+	install       sync.Once
+}
+
+// newNickManager sets up nick handling for a connection
+func newNickManager(conn *Connection, cfg *config.Config) *NickManager {
+	n := &NickManager{
+		conn:          conn,
+		primary:       cfg.Nick,
+		alternates:    cfg.AltNicks,
+		method:        cfg.NickRecovery.Method,
+		checkInterval: defaultNickCheckInterval,
+	}
+	if n.method == "" {
+		n.method = NickRecoveryRegain
+	}
+	if cfg.NickRecovery.CheckIntervalSeconds > 0 {
+		n.checkInterval = time.Duration(cfg.NickRecovery.CheckIntervalSeconds) * time.Second
+	}
+
+	// ircevent adds its own nick-in-use handler, which appends _N to the nick, when it first
+	// connects. The dialer runs right after that, so ours replaces it there.
+	dial := conn.DialContext
+	conn.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		n.install.Do(n.installCallbacks)
+		n.mu.Lock()
+		n.attempt = 0
+		n.mu.Unlock()
+		return dial(ctx, network, address)
+	}
+
+	conn.AddConnectCallback(n.handleConnect)
+	conn.AddCallback("NICK", n.handleNick)
+	conn.AddCallback(replyCodes["RPL_ISON"], n.handleIson)
+	conn.AddCallback(rplMonOffline, n.handleMonOffline)
+
+	go n.checkLoop()
+	return n
+}
+
+// installCallbacks swaps the library's nick-in-use handling for ours
+func (n *NickManager) installCallbacks() {
+	for _, code := range []string{ircevent.ERR_NICKNAMEINUSE, ircevent.ERR_UNAVAILRESOURCE} {
+		n.conn.ClearCallback(code)
+		n.conn.AddCallback(code, n.handleNickUnavailable)
+	}
+}
+
+// Primary returns the nick the bot is configured to use
+func (n *NickManager) Primary() string {
+	return n.primary
+}
+
+// HasPrimary reports whether the bot currently uses its configured nick
+func (n *NickManager) HasPrimary() bool {
+	return strings.EqualFold(n.conn.CurrentNick(), n.primary)
+}
+
+// handleNickUnavailable tries the next alternate nick while registering,
+// and falls back to NickServ when the bot fails to take back its own nick later
+func (n *NickManager) handleNickUnavailable(e ircmsg.Message) {
+	nick := ""
+	if len(e.Params) > 1 {
+		nick = e.Params[1]
+	}
+	color.Red(">> Nickname is already in use: %s", nick)
+
+	if n.conn.CurrentNick() != "" {
+		if strings.EqualFold(nick, n.primary) {
+			n.recover()
+		}
+		return
+	}
+
+	n.mu.Lock()
+	next := ""
+	if n.attempt < len(n.alternates) {
+		next = n.alternates[n.attempt]
+	} else {
+		next = fmt.Sprintf("%s_%d", n.primary, n.attempt-len(n.alternates))
+	}
+	n.attempt++
+	n.mu.Unlock()
+
+	color.Yellow(">> Trying nickname %s", next)
+	n.conn.Send("NICK", next)
+}
+
+// handleConnect starts getting the primary nick back if the bot registered with another one
+func (n *NickManager) handleConnect(e ircmsg.Message) {
+	n.mu.Lock()
+	n.monitoring = false
+	n.mu.Unlock()
+
+	if n.HasPrimary() {
+		return
+	}
+
+	color.Yellow(">> Connected as %s instead of %s", n.conn.CurrentNick(), n.primary)
+	if _, supported := n.conn.ISupport()["MONITOR"]; supported {
+		n.mu.Lock()
+		n.monitoring = true
+		n.mu.Unlock()
+		n.conn.Send("MONITOR", "+", n.primary)
+	}
+	n.recover()
+}
+
+// handleNick stops watching once the bot has its primary nick again
+func (n *NickManager) handleNick(e ircmsg.Message) {
+	if len(e.Params) == 0 || !strings.EqualFold(e.Params[0], n.primary) || !isOwnNick(n.conn, e.Params[0]) {
+		return
+	}
+	color.Green(">> Got the nickname %s back", n.primary)
+
+	n.mu.Lock()
+	monitoring := n.monitoring
+	n.monitoring = false
+	n.mu.Unlock()
+	if monitoring {
+		n.conn.Send("MONITOR", "-", n.primary)
+	}
+}
+
+// handleIson takes the primary nick when ISON no longer lists it
+func (n *NickManager) handleIson(e ircmsg.Message) {
+	if len(e.Params) < 2 || n.HasPrimary() {
+		return
+	}
+	for _, nick := range strings.Fields(e.Params[1]) {
+		if strings.EqualFold(nick, n.primary) {
+			return
+		}
+	}
+	n.conn.Send("NICK", n.primary)
+}
+
+// handleMonOffline takes the primary nick as soon as MONITOR reports it went offline
+func (n *NickManager) handleMonOffline(e ircmsg.Message) {
+	if len(e.Params) < 2 || n.HasPrimary() {
+		return
+	}
+	for _, target := range strings.Split(e.Params[1], ",") {
+		if strings.EqualFold(ExtractNickname(target), n.primary) {
+			n.conn.Send("NICK", n.primary)
+			return
+		}
+	}
+}
+
+// recover asks NickServ to free the primary nick, at most once every few minutes
+func (n *NickManager) recover() {
+	cfg := n.conn.Config
+	if n.method == NickRecoveryNone || cfg.NickServPass == "" {
+		return
+	}
+
+	n.mu.Lock()
+	if time.Since(n.lastRecovery) < nickRecoveryCooldown {
+		n.mu.Unlock()
+		return
+	}
+	n.lastRecovery = time.Now()
+	n.mu.Unlock()
+
+	switch n.method {
+	case NickRecoveryGhost:
+		color.Yellow(">> Asking NickServ to ghost %s", n.primary)
+		n.conn.Privmsg("NickServ", fmt.Sprintf("GHOST %s %s", n.primary, cfg.NickServPass))
+		time.AfterFunc(ghostNickDelay, func() {
+			if !n.HasPrimary() {
+				n.conn.Send("NICK", n.primary)
+			}
+		})
+	default:
+		// REGAIN both frees the nick and changes ours to it
+		color.Yellow(">> Asking NickServ to regain %s", n.primary)
+		n.conn.Privmsg("NickServ", fmt.Sprintf("REGAIN %s %s", n.primary, cfg.NickServPass))
+	}
+}
+
+// checkLoop polls with ISON for the primary nick on servers without MONITOR
+func (n *NickManager) checkLoop() {
+	ticker := time.NewTicker(n.checkInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n.mu.Lock()
+		monitoring := n.monitoring
+		n.mu.Unlock()
+
+		if monitoring || !n.conn.Connected() || n.conn.CurrentNick() == "" || n.HasPrimary() {
+			continue
+		}
+		n.conn.Send("ISON", n.primary)
+	}
+}
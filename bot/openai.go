@@ -1,7 +1,6 @@
 package bot
 
 import (
-	"mbot/config"
 	"strings"
 
 	ai "mbot/bot/openai"
@@ -15,6 +14,7 @@ var (
 )
 
 const maxHistoryLength = 20 // Maximum number of messages to keep in the conversation history
+const maxAnswerLines = 3    // Answers that need more IRC lines than this are pasted instead
 
 func getUserConversation(userID string) []openai.ChatCompletionMessage {
 	mu.Lock()
@@ -42,7 +42,7 @@ func WipeUserMemory(userID string) {
 func CallOpenAI(connection *Connection, sender, target, message string) {
 	color.Cyan(">> Mentions the bot's nickname: %s", message)
 
-	botNick := GetBotNickname(connection.Connection)
+	botNick := GetBotNickname(connection)
 	//message, imageURL := ai.ExtractImageURL(message)
 	message = strings.Replace(message, botNick, "", 1)
 	message = strings.TrimSpace(message)
@@ -50,7 +50,7 @@ func CallOpenAI(connection *Connection, sender, target, message string) {
 	// Add This Message was sent by user at the end of the message
 	message = message + ". This message was sent by " + sender
 
-	personality := config.GetPersonality(target)
+	personality := connection.Network.Personalities.Get(target)
 
 	NormalOpenAIRequest(connection, target, sender, message, personality)
 
@@ -120,17 +120,16 @@ func NormalOpenAIRequest(connection *Connection, target, sender, message, person
 	}
 	updateUserConversation(sender, userMessage, assistantMessage)
 
-	if len(answer) > 420 {
+	// Long answers are pasted with their formatting, short ones are joined into one paragraph
+	if len(connection.SplitMessage(target, strings.Join(strings.Fields(answer), " "))) > maxAnswerLines {
 		pasteURL, err := ai.PasteService(answer)
 		if err != nil {
 			color.Red("Error calling PasteService: %v", err)
 			return
 		}
-		connection.Privmsg(target, "The answer is too long for a single IRC message. For your convenience, I've pasted it here: "+pasteURL)
+		connection.Privmsg(target, "The answer is too long for IRC. For your convenience, I've pasted it here: "+pasteURL)
 		return
 	}
 
-	answer = strings.Join(strings.Fields(answer), " ")
-
-	connection.Privmsg(target, answer)
+	connection.SendLong(target, strings.Join(strings.Fields(answer), " "))
 }
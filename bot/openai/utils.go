@@ -2,7 +2,6 @@ package openai
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +9,7 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 )
@@ -46,12 +46,8 @@ func PasteService(content string) (string, error) {
 		return "", fmt.Errorf("error marshaling request data: %v", err)
 	}
 
-	// Create an HTTP client with TLS configuration to skip verification
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	// The default transport verifies certificates with the TLS settings from the config
+	client := &http.Client{Timeout: 30 * time.Second}
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
 	if err != nil {
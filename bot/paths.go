@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Files shared by every network, directly in the data directory
+const (
+	TriviaQuestionsFile = "trivia_questions.json"
+	TriviaScoresFile    = "trivia_scores.json"
+	UploadsDirectory    = "uploads"
+)
+
+// DefaultDataDir is the data directory used when none is given on the command line
+const DefaultDataDir = "data"
+
+var (
+	dataDir   = DefaultDataDir
+	dataDirMu sync.RWMutex
+)
+
+// SetDataDir sets the directory every data file is read from and written to
+func SetDataDir(dir string) {
+	dataDirMu.Lock()
+	defer dataDirMu.Unlock()
+	dataDir = dir
+}
+
+// DataDir returns the data directory
+func DataDir() string {
+	dataDirMu.RLock()
+	defer dataDirMu.RUnlock()
+	return dataDir
+}
+
+// DataPath returns the path of a file in the data directory
+func DataPath(name ...string) string {
+	return filepath.Join(append([]string{DataDir()}, name...)...)
+}
+
+// AssetPath returns the path of a file shipped with the bot, such as the web templates or the kb script.
+// Files next to the executable win, so instances started from other directories find them; otherwise
+// the path is relative to the working directory as when running from a checkout.
+func AssetPath(name string) string {
+	if executable, err := os.Executable(); err == nil {
+		path := filepath.Join(filepath.Dir(executable), name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return name
+}
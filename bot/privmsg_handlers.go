@@ -1,6 +1,7 @@
 package bot
 
 import (
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +16,10 @@ func handlePrivateMessage(connection *Connection, sender, message string) {
 	color.Magenta(">> Private message from %s: %s", sender, message)
 	nickname := ExtractNickname(sender)
 
+	if strings.HasPrefix(message, "!") && handlePrivateCommand(connection, sender, message, connection.Network.Users) {
+		return
+	}
+
 	mu.Lock()
 	defer mu.Unlock()
 
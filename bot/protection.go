@@ -0,0 +1,498 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"mbot/config"
+
+	"github.com/fatih/color"
+)
+
+// Protection actions, taken in the configured order for repeated offenses
+const (
+	ActionWarn  = "warn"
+	ActionQuiet = "quiet"
+	ActionKick  = "kick"
+	ActionBan   = "ban"
+)
+
+// Default protection settings, used for every setting left at zero
+const (
+	defaultFloodLines         = 5
+	defaultFloodSeconds       = 5
+	defaultRepeatLines        = 3
+	defaultRepeatSeconds      = 60
+	defaultMaxHighlights      = 5
+	defaultCapsPercent        = 70
+	defaultCapsMinLength      = 15
+	defaultMaxFormatting      = 10
+	defaultJoinPartCount      = 4
+	defaultJoinPartSeconds    = 60
+	defaultQuietMode          = "q"
+	defaultQuietMinutes       = 10
+	defaultBanMinutes         = 60
+	defaultStrikeResetMinutes = 30
+	defaultExemptRole         = "Trusted"
+
+	// How often state of users who went quiet is dropped
+	protectionPruneInterval = 5 * time.Minute
+)
+
+var defaultProtectionActions = []string{ActionWarn, ActionQuiet, ActionKick, ActionBan}
+
+// IRC formatting control codes: bold, colour, hex colour, reset, monospace, reverse, italics, strikethrough, underline
+const formattingCodes = "\x02\x03\x04\x0f\x11\x16\x1d\x1e\x1f"
+
+// ModerationEntry is one action taken by the protection engine, as written to the moderation log
+type ModerationEntry struct {
+	Time    time.Time `json:"time"`
+	Network string    `json:"network"`
+	Channel string    `json:"channel"`
+	Nick    string    `json:"nick"`
+	Source  string    `json:"source"`
+	Offense string    `json:"offense"`
+	Detail  string    `json:"detail"`
+	Strike  int       `json:"strike"`
+	Action  string    `json:"action"`
+}
+
+// offender is what the protection engine remembers about one user in one channel
+type offender struct {
+	messages   []time.Time
+	lines      []sentLine
+	joinParts  []time.Time
+	strikes    int
+	lastStrike time.Time
+	lastSeen   time.Time
+}
+
+// sentLine is a message kept to spot repeats
+type sentLine struct {
+	text string
+	at   time.Time
+}
+
+// Protector watches channel traffic for floods and spam and escalates against offenders
+type Protector struct {
+	mu        sync.Mutex
+	conn      *Connection
+	settings  config.Protection
+	channels  map[string]bool
+	offenders map[string]*offender
+	lastPrune time.Time
+	logMu     sync.Mutex
+}
+
+// newProtector sets up flood and spam protection with the defaults filled in
+func newProtector(conn *Connection, cfg *config.Config) *Protector {
+	s := cfg.Protection
+	setDefault := func(value *int, def int) {
+		if *value <= 0 {
+			*value = def
+		}
+	}
+	setDefault(&s.FloodLines, defaultFloodLines)
+	setDefault(&s.FloodSeconds, defaultFloodSeconds)
+	setDefault(&s.RepeatLines, defaultRepeatLines)
+	setDefault(&s.RepeatSeconds, defaultRepeatSeconds)
+	setDefault(&s.MaxHighlights, defaultMaxHighlights)
+	setDefault(&s.CapsPercent, defaultCapsPercent)
+	setDefault(&s.CapsMinLength, defaultCapsMinLength)
+	setDefault(&s.MaxFormatting, defaultMaxFormatting)
+	setDefault(&s.JoinPartCount, defaultJoinPartCount)
+	setDefault(&s.JoinPartSeconds, defaultJoinPartSeconds)
+	setDefault(&s.QuietMinutes, defaultQuietMinutes)
+	setDefault(&s.BanMinutes, defaultBanMinutes)
+	setDefault(&s.StrikeResetMinutes, defaultStrikeResetMinutes)
+	if s.QuietMode == "" {
+		s.QuietMode = defaultQuietMode
+	}
+	if s.ExemptRole == "" {
+		s.ExemptRole = defaultExemptRole
+	}
+	if len(s.Actions) == 0 {
+		s.Actions = defaultProtectionActions
+	}
+
+	p := &Protector{
+		conn:      conn,
+		settings:  s,
+		channels:  make(map[string]bool),
+		offenders: make(map[string]*offender),
+	}
+	for _, channel := range s.Channels {
+		p.channels[strings.ToLower(channel)] = true
+	}
+	return p
+}
+
+// Protects reports whether a channel is watched
+func (p *Protector) Protects(channel string) bool {
+	return p.settings.Enabled && (len(p.channels) == 0 || p.channels[strings.ToLower(channel)])
+}
+
+// CheckMessage looks at a channel message or action and acts on the sender if it breaks a rule.
+// It reports whether it did, so the message is not handled any further.
+func (p *Protector) CheckMessage(channel, source, message string, users map[string]User) bool {
+	if !p.Protects(channel) || p.exempt(channel, source, users) {
+		return false
+	}
+
+	offense, detail := p.detectMessage(channel, source, message)
+	if offense == "" {
+		return false
+	}
+	p.punish(channel, source, offense, detail)
+	return true
+}
+
+// CheckJoinPart counts a join or part and acts on users who keep doing it
+func (p *Protector) CheckJoinPart(channel, source string, users map[string]User) {
+	if !p.Protects(channel) || p.exempt(channel, source, users) {
+		return
+	}
+
+	window := time.Duration(p.settings.JoinPartSeconds) * time.Second
+	p.mu.Lock()
+	o := p.offender(channel, source)
+	o.joinParts = append(recentTimes(o.joinParts, window), time.Now())
+	count := len(o.joinParts)
+	if count >= p.settings.JoinPartCount {
+		o.joinParts = nil
+	}
+	p.mu.Unlock()
+
+	if count >= p.settings.JoinPartCount {
+		p.punish(channel, source, "join/part flood", fmt.Sprintf("%d joins and parts in %ds", count, p.settings.JoinPartSeconds))
+	}
+}
+
+// exempt reports whether a user is never acted on: the bot itself, channel operators
+// and users with the exempt role or above
+func (p *Protector) exempt(channel, source string, users map[string]User) bool {
+	nick := ExtractNickname(source)
+	if strings.EqualFold(nick, p.conn.CurrentNick()) || p.conn.Channels.IsOp(channel, nick) {
+		return true
+	}
+	level := GetUserRoleLevelByAccount(users, p.conn.Accounts.Get(nick), source, channel)
+	required, valid := UserRoles[p.settings.ExemptRole]
+	return valid && level >= required
+}
+
+// detectMessage returns the rule a message breaks, if any
+func (p *Protector) detectMessage(channel, source, message string) (offense, detail string) {
+	s := p.settings
+	now := time.Now()
+
+	p.mu.Lock()
+	o := p.offender(channel, source)
+
+	o.messages = append(recentTimes(o.messages, time.Duration(s.FloodSeconds)*time.Second), now)
+	if len(o.messages) >= s.FloodLines {
+		count := len(o.messages)
+		o.messages = nil
+		p.mu.Unlock()
+		return "flood", fmt.Sprintf("%d lines in %ds", count, s.FloodSeconds)
+	}
+
+	text := strings.ToLower(strings.Join(strings.Fields(stripFormatting(message)), " "))
+	repeats := 1
+	lines := o.lines[:0]
+	for _, line := range o.lines {
+		if now.Sub(line.at) < time.Duration(s.RepeatSeconds)*time.Second {
+			lines = append(lines, line)
+			if line.text == text {
+				repeats++
+			}
+		}
+	}
+	o.lines = append(lines, sentLine{text: text, at: now})
+	if repeats >= s.RepeatLines {
+		o.lines = nil
+		p.mu.Unlock()
+		return "repeat", fmt.Sprintf("same line %d times in %ds", repeats, s.RepeatSeconds)
+	}
+	p.mu.Unlock()
+
+	if highlights := p.countHighlights(channel, source, message); highlights >= s.MaxHighlights {
+		return "mass highlight", fmt.Sprintf("%d nicks highlighted", highlights)
+	}
+
+	if formatting := countFormatting(message); formatting > s.MaxFormatting {
+		return "formatting", fmt.Sprintf("%d colour and formatting codes", formatting)
+	}
+
+	letters, upper := 0, 0
+	for _, r := range stripFormatting(message) {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	if letters >= s.CapsMinLength && upper*100 >= letters*s.CapsPercent {
+		return "caps", fmt.Sprintf("%d%% capitals", upper*100/letters)
+	}
+
+	return "", ""
+}
+
+// countHighlights counts the distinct channel members named in a message, not counting the sender
+func (p *Protector) countHighlights(channel, source, message string) int {
+	members := make(map[string]bool)
+	for _, member := range p.conn.Channels.Members(channel) {
+		members[strings.ToLower(member.Nick)] = true
+	}
+	delete(members, strings.ToLower(ExtractNickname(source)))
+
+	named := make(map[string]bool)
+	words := strings.FieldsFunc(stripFormatting(message), func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(",:;!?.'\"()<>@+", r)
+	})
+	for _, word := range words {
+		word = strings.ToLower(word)
+		if members[word] {
+			named[word] = true
+		}
+	}
+	return len(named)
+}
+
+// punish takes the next action for a user who broke a rule and logs it
+func (p *Protector) punish(channel, source, offense, detail string) {
+	s := p.settings
+	now := time.Now()
+
+	p.mu.Lock()
+	o := p.offender(channel, source)
+	if now.Sub(o.lastStrike) > time.Duration(s.StrikeResetMinutes)*time.Minute {
+		o.strikes = 0
+	}
+	o.strikes++
+	o.lastStrike = now
+	strike := o.strikes
+	p.mu.Unlock()
+
+	action := s.Actions[len(s.Actions)-1]
+	if strike <= len(s.Actions) {
+		action = s.Actions[strike-1]
+	}
+
+	nick := ExtractNickname(source)
+	conn := p.conn
+	if action != ActionWarn && !conn.Channels.IsOp(channel, conn.CurrentNick()) {
+		color.Yellow(">> Cannot %s %s in %s, the bot is not an operator", action, nick, channel)
+		action = ActionWarn
+	}
+
+	reason := fmt.Sprintf("%s (%s)", offense, detail)
+	user, host, _ := strings.Cut(ExtractHostmask(source), "@")
+	mask := BuildBanMask(conn.Config.Bans.MaskStyle, nick, user, host)
+
+	switch action {
+	case ActionQuiet:
+		conn.Send("MODE", channel, "+"+s.QuietMode, mask)
+		conn.Notice(nick, fmt.Sprintf("You have been quieted in %s for %d minutes: %s", channel, s.QuietMinutes, offense))
+		p.rememberTimed(channel, s.QuietMode, mask, nick, reason, time.Duration(s.QuietMinutes)*time.Minute)
+	case ActionKick:
+		conn.Send("KICK", channel, nick, "Stop it: "+offense)
+	case ActionBan:
+		conn.Send("MODE", channel, "+b", mask)
+		conn.Send("KICK", channel, nick, fmt.Sprintf("Banned for %d minutes: %s", s.BanMinutes, offense))
+		p.rememberTimed(channel, "", mask, nick, reason, time.Duration(s.BanMinutes)*time.Minute)
+	default:
+		action = ActionWarn
+		conn.Notice(nick, fmt.Sprintf("Please stop, this is against the rules of %s: %s", channel, offense))
+	}
+
+	color.Red(">> Protection in %s: %s by %s (%s), strike %d, %s", channel, offense, source, detail, strike, action)
+	entry := ModerationEntry{
+		Time:    now,
+		Network: conn.Network.Name,
+		Channel: channel,
+		Nick:    nick,
+		Source:  source,
+		Offense: offense,
+		Detail:  detail,
+		Strike:  strike,
+		Action:  action,
+	}
+	if err := p.log(entry); err != nil {
+		color.Red(">> Error writing the moderation log: %v", err)
+	}
+}
+
+// rememberTimed stores a quiet or ban so the scheduler lifts it later
+func (p *Protector) rememberTimed(channel, mode, mask, nick, reason string, duration time.Duration) {
+	now := time.Now()
+	ban := TimedBan{
+		Network:   p.conn.Network.Name,
+		Channel:   channel,
+		Mode:      mode,
+		Mask:      mask,
+		Nick:      nick,
+		SetBy:     p.conn.CurrentNick(),
+		Reason:    reason,
+		SetAt:     now,
+		ExpiresAt: now.Add(duration),
+	}
+	if err := p.conn.Network.Bans.Add(ban); err != nil {
+		color.Red(">> Error saving bans: %v", err)
+	}
+}
+
+// log appends an entry to the moderation log of the network
+func (p *Protector) log(entry ModerationEntry) error {
+	p.logMu.Lock()
+	defer p.logMu.Unlock()
+
+	file, err := os.OpenFile(p.conn.Network.ModerationLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening moderation log: %w", err)
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding moderation log entry: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing moderation log: %w", err)
+	}
+	return nil
+}
+
+// offender returns the state of a user in a channel, creating it when needed. The caller holds the lock.
+func (p *Protector) offender(channel, source string) *offender {
+	now := time.Now()
+	if now.Sub(p.lastPrune) > protectionPruneInterval {
+		p.prune(now)
+	}
+
+	key := strings.ToLower(channel) + " " + NormalizeHostmask(ExtractHostmask(source))
+	o, exists := p.offenders[key]
+	if !exists {
+		o = &offender{}
+		p.offenders[key] = o
+	}
+	o.lastSeen = now
+	return o
+}
+
+// prune drops users who have not been seen for longer than anything is remembered. The caller holds the lock.
+func (p *Protector) prune(now time.Time) {
+	p.lastPrune = now
+	keep := time.Duration(p.settings.StrikeResetMinutes) * time.Minute
+	for _, seconds := range []int{p.settings.RepeatSeconds, p.settings.JoinPartSeconds} {
+		if window := time.Duration(seconds) * time.Second; window > keep {
+			keep = window
+		}
+	}
+	for key, o := range p.offenders {
+		if now.Sub(o.lastSeen) > keep {
+			delete(p.offenders, key)
+		}
+	}
+}
+
+// ReadModerationLog returns the last entries of a moderation log, optionally only those of one channel
+func ReadModerationLog(filePath, channel string, limit int) ([]ModerationEntry, error) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error opening moderation log: %w", err)
+	}
+	defer file.Close()
+
+	var entries []ModerationEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry ModerationEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if channel != "" && !strings.EqualFold(entry.Channel, channel) {
+			continue
+		}
+		entries = append(entries, entry)
+		if limit > 0 && len(entries) > limit {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading moderation log: %w", err)
+	}
+	return entries, nil
+}
+
+// recentTimes returns the times within a window from now
+func recentTimes(times []time.Time, window time.Duration) []time.Time {
+	now := time.Now()
+	recent := times[:0]
+	for _, t := range times {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// countFormatting counts the colour and formatting codes in a message
+func countFormatting(message string) int {
+	count := 0
+	for i := 0; i < len(message); i++ {
+		if strings.IndexByte(formattingCodes, message[i]) >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// stripFormatting removes colour and formatting codes, including colour numbers, from a message
+func stripFormatting(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		switch {
+		case c == '\x03':
+			// \x03 is followed by up to two digits of foreground and optionally a comma and two of background
+			end := skipDigits(message, i+1, 2)
+			if end > i+1 && end+1 < len(message) && message[end] == ',' && isDigit(message[end+1]) {
+				end = skipDigits(message, end+1, 2)
+			}
+			i = end - 1
+		case c == '\x04':
+			// Hex colours are six hex digits
+			j := i + 1
+			for j < len(message) && j < i+7 && strings.IndexByte("0123456789abcdefABCDEF", message[j]) >= 0 {
+				j++
+			}
+			i = j - 1
+		case strings.IndexByte(formattingCodes, c) >= 0:
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// skipDigits returns the index after at most max digits starting at i
+func skipDigits(s string, i, max int) int {
+	for n := 0; n < max && i < len(s) && isDigit(s[i]); n++ {
+		i++
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
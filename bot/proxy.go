@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"mbot/config"
+
+	"golang.org/x/net/proxy"
+)
+
+// dialFunc opens a connection to an address
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// newProxyDialer returns the dialer for the proxy settings, a direct one when no proxy is set.
+// Invalid settings give a dialer that fails with the reason, LoadConfig rejects them before that.
+func newProxyDialer(settings config.Proxy) dialFunc {
+	direct := &net.Dialer{}
+	if !settings.Enabled() {
+		return direct.DialContext
+	}
+	proxyURL, err := settings.Parse()
+	if err != nil {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, err
+		}
+	}
+
+	if proxyURL.Scheme == "socks5" {
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, direct)
+		if err != nil {
+			return func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return nil, err
+			}
+		}
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.(proxy.ContextDialer).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, fmt.Errorf("error connecting through proxy %s: %w", proxyURL.Redacted(), err)
+			}
+			return conn, nil
+		}
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialHTTPConnect(ctx, direct, proxyURL, addr)
+		if err != nil {
+			return nil, fmt.Errorf("error connecting through proxy %s: %w", proxyURL.Redacted(), err)
+		}
+		return conn, nil
+	}
+}
+
+// dialHTTPConnect opens a tunnel to addr with an HTTP CONNECT request
+func dialHTTPConnect(ctx context.Context, direct *net.Dialer, proxyURL *url.URL, addr string) (net.Conn, error) {
+	conn, err := direct.DialContext(ctx, "tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with the proxy failed: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := request.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error sending CONNECT: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error reading the CONNECT response: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused the connection: %s", response.Status)
+	}
+
+	conn.SetDeadline(time.Time{})
+	// The server may talk first, and part of that can already be in the reader
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn reads through a buffer that may hold data read ahead of the connection
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read reads from the buffer first
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
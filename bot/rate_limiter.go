@@ -2,6 +2,7 @@ package bot
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
@@ -160,3 +161,29 @@ func FormatDuration(d time.Duration) string {
 	seconds := int(d.Seconds()) % 60
 	return fmt.Sprintf("%d days, %d hours, %d minutes and %d seconds", days, hours, minutes, seconds)
 }
+
+// FormatRoughDuration formats a duration with its two largest units, like "3 hours and 5 minutes"
+func FormatRoughDuration(d time.Duration) string {
+	units := []struct {
+		name   string
+		length time.Duration
+	}{{"day", 24 * time.Hour}, {"hour", time.Hour}, {"minute", time.Minute}, {"second", time.Second}}
+
+	var parts []string
+	for _, unit := range units {
+		if n := int(d / unit.length); n > 0 || (len(parts) == 0 && unit.length == time.Second) {
+			d -= time.Duration(n) * unit.length
+			if n == 1 {
+				parts = append(parts, fmt.Sprintf("1 %s", unit.name))
+			} else {
+				parts = append(parts, fmt.Sprintf("%d %ss", n, unit.name))
+			}
+		} else if len(parts) > 0 {
+			break
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+	return strings.Join(parts, " and ")
+}
@@ -0,0 +1,238 @@
+package bot
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"mbot/config"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+	"github.com/fatih/color"
+)
+
+// Default backoff bounds used when the config does not set them
+const (
+	defaultReconnectMinDelay = 5 * time.Second
+	defaultReconnectMaxDelay = 5 * time.Minute
+)
+
+// ConnectionStatus is a snapshot of the connection health that admins can query
+type ConnectionStatus struct {
+	Server         string
+	Connected      bool
+	ConnectedAt    time.Time
+	DisconnectedAt time.Time
+	Reconnects     int
+	FailedAttempts int
+	LastError      string
+	LastErrorAt    time.Time
+}
+
+// Supervisor tracks the connection lifecycle, computes reconnect delays and
+// remembers the channels the bot is in so they can be restored after a reconnect
+type Supervisor struct {
+	mu       sync.Mutex
+	irc      *ircevent.Connection
+	status   ConnectionStatus
+	minDelay time.Duration
+	maxDelay time.Duration
+	lastDial time.Time
+	channels map[string]struct{}
+
+	dial      dialFunc                // direct or through the configured proxy
+	tlsConfig *tls.Config             // TLS is layered on the dialed connection when set
+	wrap      func(net.Conn) net.Conn // wraps the connection once it is up, for SASL
+}
+
+// newSupervisor creates a supervisor for the connection and hooks it into the dialer
+func newSupervisor(irc *ircevent.Connection, cfg *config.Config) *Supervisor {
+	s := &Supervisor{
+		irc:      irc,
+		status:   ConnectionStatus{Server: irc.Server},
+		minDelay: defaultReconnectMinDelay,
+		maxDelay: defaultReconnectMaxDelay,
+		channels: make(map[string]struct{}),
+		dial:     newProxyDialer(cfg.Proxy),
+	}
+	if cfg.UseTLS {
+		s.tlsConfig = cfg.TLSConfig
+		if s.tlsConfig == nil {
+			s.tlsConfig = &tls.Config{}
+		}
+	}
+	if cfg.Reconnect.MinDelaySeconds > 0 {
+		s.minDelay = time.Duration(cfg.Reconnect.MinDelaySeconds) * time.Second
+	}
+	if cfg.Reconnect.MaxDelaySeconds > 0 {
+		s.maxDelay = time.Duration(cfg.Reconnect.MaxDelaySeconds) * time.Second
+	}
+	if s.maxDelay < s.minDelay {
+		s.maxDelay = s.minDelay
+	}
+
+	// ircevent waits ReconnectFreq from the start of the previous attempt before
+	// dialing again, so the delay is kept up to date from the dialer and the
+	// disconnect callback. Both run before the library reads the value.
+	irc.ReconnectFreq = s.minDelay
+	irc.DialContext = s.dialContext
+	irc.AddDisconnectCallback(s.handleDisconnect)
+
+	return s
+}
+
+// Status returns a copy of the current connection status
+func (s *Supervisor) Status() ConnectionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// backoff returns the delay before the given attempt, with up to 50% jitter added
+func (s *Supervisor) backoff(attempt int) time.Duration {
+	delay := s.minDelay
+	for i := 0; i < attempt && delay < s.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.maxDelay {
+		delay = s.maxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// dialContext counts connection attempts and schedules the next one in case this one fails.
+// The TLS handshake happens here rather than in ircevent, on top of the proxy tunnel when there is one.
+func (s *Supervisor) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	s.mu.Lock()
+	s.lastDial = time.Now()
+	s.status.FailedAttempts++
+	s.irc.ReconnectFreq = s.backoff(s.status.FailedAttempts)
+	s.mu.Unlock()
+
+	conn, err := s.dial(ctx, network, addr)
+	if err == nil && s.tlsConfig != nil {
+		conn, err = s.handshake(ctx, conn, addr)
+	}
+	if err != nil {
+		s.recordError(err.Error())
+		color.Red(">> Failed to connect to %s: %v", addr, err)
+		return nil, err
+	}
+	if s.wrap != nil {
+		conn = s.wrap(conn)
+	}
+	return conn, nil
+}
+
+// handshake starts TLS on a dialed connection, checking the certificate against the server's host name by default
+func (s *Supervisor) handshake(ctx context.Context, conn net.Conn, addr string) (net.Conn, error) {
+	tlsConfig := s.tlsConfig.Clone()
+	if tlsConfig.ServerName == "" && !tlsConfig.InsecureSkipVerify {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		tlsConfig.ServerName = host
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// handleConnect marks the connection as established and resets the backoff
+func (s *Supervisor) handleConnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.status.DisconnectedAt.IsZero() {
+		s.status.Reconnects++
+		color.Green(">> Reconnected to %s after %s (reconnect #%d)", s.status.Server, FormatDuration(time.Since(s.status.DisconnectedAt)), s.status.Reconnects)
+	}
+	s.status.Connected = true
+	s.status.ConnectedAt = time.Now()
+	s.status.FailedAttempts = 0
+}
+
+// handleDisconnect records the disconnect and schedules the first reconnect attempt
+func (s *Supervisor) handleDisconnect(e ircmsg.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.Connected = false
+	s.status.DisconnectedAt = time.Now()
+	s.irc.ReconnectFreq = time.Since(s.lastDial) + s.backoff(0)
+
+	color.Red(">> Disconnected from %s, reconnecting in about %s", s.status.Server, FormatDuration(s.irc.ReconnectFreq-time.Since(s.lastDial)))
+}
+
+// recordError stores the last error seen on the connection
+func (s *Supervisor) recordError(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastError = message
+	s.status.LastErrorAt = time.Now()
+}
+
+// trackJoin remembers a channel the bot has joined
+func (s *Supervisor) trackJoin(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels[strings.ToLower(channel)] = struct{}{}
+}
+
+// trackPart forgets a channel the bot has left or was kicked from
+func (s *Supervisor) trackPart(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.channels, strings.ToLower(channel))
+}
+
+// Channels returns the channels the bot was in at runtime
+func (s *Supervisor) Channels() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channels := make([]string, 0, len(s.channels))
+	for channel := range s.channels {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// channelsToJoin merges the configured channels with the ones joined at runtime
+func (s *Supervisor) channelsToJoin(configured []string) []string {
+	seen := make(map[string]struct{})
+	var channels []string
+	for _, channel := range append(configured, s.Channels()...) {
+		key := strings.ToLower(channel)
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// String formats the status for an IRC reply
+func (st ConnectionStatus) String() string {
+	var state string
+	if st.Connected {
+		state = fmt.Sprintf("Connected to %s for %s", st.Server, FormatDuration(time.Since(st.ConnectedAt)))
+	} else {
+		state = fmt.Sprintf("Disconnected from %s (%d failed attempts)", st.Server, st.FailedAttempts)
+	}
+	state += fmt.Sprintf(", reconnects: %d", st.Reconnects)
+	if st.LastError != "" {
+		state += fmt.Sprintf(", last error %s ago: %s", FormatDuration(time.Since(st.LastErrorAt)), st.LastError)
+	}
+	return state
+}
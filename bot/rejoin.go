@@ -0,0 +1,277 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"mbot/config"
+
+	"github.com/fatih/color"
+)
+
+// Default rejoin settings used when the config does not set them
+const (
+	defaultRejoinDelay       = 5 * time.Second
+	defaultRejoinMaxDelay    = 5 * time.Minute
+	defaultRejoinMaxAttempts = 10
+	defaultChanServNick      = "ChanServ"
+)
+
+// Incident types
+const (
+	IncidentKick       = "kick"
+	IncidentBanned     = "banned"
+	IncidentInviteOnly = "invite_only"
+	IncidentFull       = "channel_full"
+	IncidentBadKey     = "bad_key"
+	IncidentRejoined   = "rejoined"
+	IncidentGaveUp     = "gave_up"
+)
+
+// Incident is something that kept the bot out of a channel, as written to the incident log
+type Incident struct {
+	Time    time.Time `json:"time"`
+	Network string    `json:"network"`
+	Channel string    `json:"channel"`
+	Type    string    `json:"type"`
+	By      string    `json:"by,omitempty"` // who kicked the bot
+	Reason  string    `json:"reason,omitempty"`
+	Attempt int       `json:"attempt,omitempty"`
+}
+
+// rejoinState is a channel the bot is trying to get back into
+type rejoinState struct {
+	channel  string
+	attempts int
+	timer    *time.Timer
+}
+
+// Rejoiner gets the bot back into channels it was kicked from or could not join
+type Rejoiner struct {
+	conn        *Connection
+	settings    config.Rejoin
+	minDelay    time.Duration
+	maxDelay    time.Duration
+	maxAttempts int
+	chanServ    string
+
+	mu       sync.Mutex
+	channels map[string]*rejoinState // lowercase channel -> state
+	logMu    sync.Mutex
+}
+
+// newRejoiner creates the rejoiner of a connection from its config
+func newRejoiner(conn *Connection, cfg *config.Config) *Rejoiner {
+	r := &Rejoiner{
+		conn:        conn,
+		settings:    cfg.Rejoin,
+		minDelay:    defaultRejoinDelay,
+		maxDelay:    defaultRejoinMaxDelay,
+		maxAttempts: defaultRejoinMaxAttempts,
+		chanServ:    defaultChanServNick,
+		channels:    make(map[string]*rejoinState),
+	}
+	if cfg.Rejoin.DelaySeconds > 0 {
+		r.minDelay = time.Duration(cfg.Rejoin.DelaySeconds) * time.Second
+	}
+	if cfg.Rejoin.MaxDelaySeconds > 0 {
+		r.maxDelay = time.Duration(cfg.Rejoin.MaxDelaySeconds) * time.Second
+	}
+	if r.maxDelay < r.minDelay {
+		r.maxDelay = r.minDelay
+	}
+	if cfg.Rejoin.MaxAttempts > 0 {
+		r.maxAttempts = cfg.Rejoin.MaxAttempts
+	}
+	if cfg.Rejoin.ChanServNick != "" {
+		r.chanServ = cfg.Rejoin.ChanServNick
+	}
+	return r
+}
+
+// Pending reports whether the bot is trying to get back into a channel
+func (r *Rejoiner) Pending(channel string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, exists := r.channels[strings.ToLower(channel)]
+	return exists
+}
+
+// kicked records a kick of the bot, tells the owners and starts rejoining when enabled
+func (r *Rejoiner) kicked(channel, by, reason string) {
+	r.record(Incident{Channel: channel, Type: IncidentKick, By: by, Reason: reason})
+
+	text := fmt.Sprintf("I was kicked from %s by %s", channel, by)
+	if reason != "" {
+		text += ": " + reason
+	}
+	if r.settings.Enabled {
+		text += ". I'll try to rejoin."
+	}
+	r.conn.NotifyOwners(text)
+
+	if r.settings.Enabled {
+		r.schedule(channel)
+	}
+}
+
+// refused handles a join refused with ERR_BANNEDFROMCHAN, ERR_INVITEONLYCHAN, ERR_CHANNELISFULL or
+// ERR_BADCHANNELKEY. ChanServ is asked for help with bans and invites, and another attempt is scheduled,
+// for channels the bot is rejoining or is meant to be in.
+func (r *Rejoiner) refused(channel, incident string) {
+	if !r.settings.Enabled {
+		return
+	}
+	first := !r.Pending(channel)
+	if first && !r.conn.wantsChannel(channel) {
+		return
+	}
+
+	r.mu.Lock()
+	attempt := 0
+	if state, exists := r.channels[strings.ToLower(channel)]; exists {
+		attempt = state.attempts
+	}
+	r.mu.Unlock()
+	r.record(Incident{Channel: channel, Type: incident, Attempt: attempt})
+
+	command, what := "", ""
+	switch incident {
+	case IncidentBanned:
+		command, what = "UNBAN", "I'm banned from"
+	case IncidentInviteOnly:
+		command, what = "INVITE", "I need an invite to"
+	case IncidentFull:
+		what = "The channel is full:"
+	case IncidentBadKey:
+		what = "I don't have the right key for"
+	}
+	if r.settings.UseChanServ && command != "" {
+		color.Yellow(">> Asking %s to %s the bot in %s", r.chanServ, strings.ToLower(command), channel)
+		r.conn.Privmsg(r.chanServ, command+" "+channel)
+	}
+	if first {
+		r.conn.NotifyOwners(fmt.Sprintf("%s %s and can't get back in, I'll keep trying.", what, channel))
+	}
+	r.schedule(channel)
+}
+
+// joined stops the attempts once the bot is back in a channel
+func (r *Rejoiner) joined(channel string) {
+	r.mu.Lock()
+	state, exists := r.channels[strings.ToLower(channel)]
+	if exists {
+		if state.timer != nil {
+			state.timer.Stop()
+		}
+		delete(r.channels, strings.ToLower(channel))
+	}
+	r.mu.Unlock()
+
+	if exists {
+		color.Green(">> Back in %s after %d attempts", channel, state.attempts)
+		r.record(Incident{Channel: channel, Type: IncidentRejoined, Attempt: state.attempts})
+	}
+}
+
+// reset stops every attempt, for example when the connection drops
+func (r *Rejoiner) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, state := range r.channels {
+		if state.timer != nil {
+			state.timer.Stop()
+		}
+		delete(r.channels, key)
+	}
+}
+
+// schedule plans the next attempt to join a channel, giving up after the last one
+func (r *Rejoiner) schedule(channel string) {
+	r.mu.Lock()
+	key := strings.ToLower(channel)
+	state, exists := r.channels[key]
+	if !exists {
+		state = &rejoinState{channel: channel}
+		r.channels[key] = state
+	}
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	if state.attempts >= r.maxAttempts {
+		delete(r.channels, key)
+		r.mu.Unlock()
+
+		color.Red(">> Giving up on rejoining %s after %d attempts", channel, state.attempts)
+		r.record(Incident{Channel: channel, Type: IncidentGaveUp, Attempt: state.attempts})
+		r.conn.NotifyOwners(fmt.Sprintf("I gave up on rejoining %s after %d attempts.", channel, state.attempts))
+		return
+	}
+	delay := r.backoff(state.attempts)
+	state.attempts++
+	state.timer = time.AfterFunc(delay, func() {
+		if r.conn.Connected() {
+			r.conn.Join(channel)
+		}
+	})
+	r.mu.Unlock()
+
+	color.Yellow(">> Rejoining %s in %s (attempt %d of %d)", channel, FormatDuration(delay.Round(time.Second)), state.attempts, r.maxAttempts)
+}
+
+// backoff returns the delay before the given attempt, with up to 25% jitter added
+func (r *Rejoiner) backoff(attempt int) time.Duration {
+	delay := r.minDelay
+	for i := 0; i < attempt && delay < r.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > r.maxDelay {
+		delay = r.maxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/4+1))
+}
+
+// record appends an incident to the incident log of the network
+func (r *Rejoiner) record(incident Incident) {
+	incident.Time = time.Now()
+	incident.Network = r.conn.Network.Name
+
+	r.logMu.Lock()
+	defer r.logMu.Unlock()
+	if err := appendIncident(r.conn.Network.IncidentLogPath(), incident); err != nil {
+		color.Red(">> Error writing the incident log: %v", err)
+	}
+}
+
+// appendIncident writes one incident as a JSON line
+func appendIncident(filePath string, incident Incident) error {
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening incident log: %w", err)
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(incident)
+	if err != nil {
+		return fmt.Errorf("error encoding incident: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error writing incident log: %w", err)
+	}
+	return nil
+}
+
+// wantsChannel reports whether a channel is joined on connect or was joined at runtime
+func (c *Connection) wantsChannel(channel string) bool {
+	for _, name := range c.Supervisor.channelsToJoin(append(c.Config.AutoJoinChannels(), c.Network.Joined.Names(c.Network.Name)...)) {
+		if strings.EqualFold(name, channel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // Timezones work on hosts without a zoneinfo database too
+
+	"github.com/fatih/color"
+)
+
+// Reminder limits
+const (
+	MaxRemindersPerUser = 20
+	MaxReminderDistance = 366 * 24 * time.Hour
+
+	reminderCheckInterval = 5 * time.Second
+)
+
+var ErrTooManyReminders = errors.New("too many pending reminders")
+
+// Reminder is a message the bot sends at a set time
+type Reminder struct {
+	ID             int       `json:"id"`
+	Network        string    `json:"network"`
+	Creator        string    `json:"creator"`
+	CreatorAccount string    `json:"creator_account,omitempty"`
+	Target         string    `json:"target"`  // the channel or nick the reminder is sent to
+	Mention        string    `json:"mention"` // the nick addressed in a channel, empty for channel reminders
+	Text           string    `json:"text"`
+	DueAt          time.Time `json:"due_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// reminderData is the layout of the reminders file
+type reminderData struct {
+	NextID    int               `json:"next_id"`
+	Reminders []Reminder        `json:"reminders"`
+	Timezones map[string]string `json:"timezones"` // by $a:account or lowercase nick
+}
+
+// ReminderStore keeps the pending reminders and the timezones of their users
+type ReminderStore struct {
+	mu       sync.Mutex
+	filePath string
+	data     reminderData
+}
+
+// LoadReminderStore loads the reminders from a file
+func LoadReminderStore(filePath string) (*ReminderStore, error) {
+	s := &ReminderStore{filePath: filePath}
+	if err := loadJSON(filePath, &s.data); err != nil {
+		return nil, err
+	}
+	if s.data.NextID == 0 {
+		s.data.NextID = 1
+	}
+	if s.data.Timezones == nil {
+		s.data.Timezones = make(map[string]string)
+	}
+	return s, nil
+}
+
+// Add stores a reminder and returns its ID
+func (s *ReminderStore) Add(reminder Reminder) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, existing := range s.data.Reminders {
+		if existing.Network == reminder.Network && existing.createdBy(reminder.Creator, reminder.CreatorAccount) {
+			count++
+		}
+	}
+	if count >= MaxRemindersPerUser {
+		return 0, ErrTooManyReminders
+	}
+
+	reminder.ID = s.data.NextID
+	s.data.NextID++
+	s.data.Reminders = append(s.data.Reminders, reminder)
+	return reminder.ID, saveJSON(s.filePath, s.data)
+}
+
+// CreatedBy returns the pending reminders of a user, soonest first
+func (s *ReminderStore) CreatedBy(network, nick, account string) []Reminder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []Reminder
+	for _, reminder := range s.data.Reminders {
+		if reminder.Network == network && reminder.createdBy(nick, account) {
+			result = append(result, reminder)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].DueAt.Before(result[j].DueAt) })
+	return result
+}
+
+// Cancel removes a pending reminder, but only for the one who set it
+func (s *ReminderStore) Cancel(network string, id int, nick, account string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, reminder := range s.data.Reminders {
+		if reminder.ID == id && reminder.Network == network && reminder.createdBy(nick, account) {
+			s.data.Reminders = append(s.data.Reminders[:i:i], s.data.Reminders[i+1:]...)
+			return true, saveJSON(s.filePath, s.data)
+		}
+	}
+	return false, nil
+}
+
+// Timezone returns the timezone of a user, UTC when none is set
+func (s *ReminderStore) Timezone(nick, account string) *time.Location {
+	s.mu.Lock()
+	name := s.data.Timezones[timezoneKey(nick, account)]
+	s.mu.Unlock()
+
+	if loc, err := time.LoadLocation(name); err == nil && name != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// SetTimezone stores the timezone of a user
+func (s *ReminderStore) SetTimezone(nick, account, name string) (*time.Location, error) {
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" || strings.EqualFold(name, "local") {
+		return nil, fmt.Errorf("unknown timezone %q, use a name like Europe/Oslo or America/New_York", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Timezones[timezoneKey(nick, account)] = loc.String()
+	return loc, saveJSON(s.filePath, s.data)
+}
+
+// takeDue removes and returns the reminders of a network that are due
+func (s *ReminderStore) takeDue(network string, now time.Time) ([]Reminder, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Reminder
+	remaining := make([]Reminder, 0, len(s.data.Reminders))
+	for _, reminder := range s.data.Reminders {
+		if reminder.Network == network && !now.Before(reminder.DueAt) {
+			due = append(due, reminder)
+		} else {
+			remaining = append(remaining, reminder)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	s.data.Reminders = remaining
+	return due, saveJSON(s.filePath, s.data)
+}
+
+// createdBy reports whether a reminder was set by a nick or account
+func (r Reminder) createdBy(nick, account string) bool {
+	if r.CreatorAccount != "" {
+		return strings.EqualFold(r.CreatorAccount, account)
+	}
+	return strings.EqualFold(r.Creator, nick)
+}
+
+// timezoneKey returns the key a user's timezone is stored under
+func timezoneKey(nick, account string) string {
+	if account != "" {
+		return AccountKeyPrefix + strings.ToLower(account)
+	}
+	return strings.ToLower(nick)
+}
+
+// ParseReminderTime reads when a reminder is due from the start of its words and returns the rest:
+//
+//	in 2h30m, in 2 hours and 30 minutes, in 1d
+//	at 17:00, at 5pm, at 2024-12-24 18:00, tomorrow at 9:00
+//
+// Absolute times are read in loc and move to the next day when they have passed today.
+func ParseReminderTime(words []string, now time.Time, loc *time.Location) (time.Time, []string, error) {
+	if len(words) == 0 {
+		return time.Time{}, nil, errors.New("missing time")
+	}
+
+	switch strings.ToLower(words[0]) {
+	case "in":
+		d, rest, err := parseSpokenDuration(words[1:])
+		if err != nil {
+			return time.Time{}, nil, err
+		}
+		return now.Add(d), rest, nil
+
+	case "tomorrow":
+		if len(words) < 3 || !strings.EqualFold(words[1], "at") {
+			return time.Time{}, nil, errors.New("use tomorrow at HH:MM")
+		}
+		hour, minute, err := parseClock(words[2])
+		if err != nil {
+			return time.Time{}, nil, err
+		}
+		local := now.In(loc).AddDate(0, 0, 1)
+		return time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc), words[3:], nil
+
+	case "at", "on":
+		if len(words) < 2 {
+			return time.Time{}, nil, errors.New("missing time after " + words[0])
+		}
+		local := now.In(loc)
+		if date, err := time.ParseInLocation("2006-01-02", words[1], loc); err == nil {
+			hour, minute, rest := 9, 0, words[2:]
+			if len(rest) > 0 && strings.EqualFold(rest[0], "at") {
+				rest = rest[1:]
+			}
+			if len(rest) > 0 {
+				if h, m, err := parseClock(rest[0]); err == nil {
+					hour, minute, rest = h, m, rest[1:]
+				}
+			}
+			return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, loc), rest, nil
+		}
+		hour, minute, err := parseClock(words[1])
+		if err != nil {
+			return time.Time{}, nil, err
+		}
+		due := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)
+		if !due.After(now) {
+			due = due.AddDate(0, 0, 1)
+		}
+		return due, words[2:], nil
+	}
+
+	return time.Time{}, nil, errors.New("start the time with in, at, on or tomorrow")
+}
+
+// parseSpokenDuration reads a duration like 2h30m or "2 hours and 30 minutes" and returns the words after it
+func parseSpokenDuration(words []string) (time.Duration, []string, error) {
+	if len(words) == 0 {
+		return 0, nil, errors.New("missing duration")
+	}
+	if d, err := ParseDuration(words[0]); err == nil {
+		return d, words[1:], nil
+	}
+
+	units := map[string]time.Duration{
+		"second": time.Second, "sec": time.Second, "s": time.Second,
+		"minute": time.Minute, "min": time.Minute, "m": time.Minute,
+		"hour": time.Hour, "hr": time.Hour, "h": time.Hour,
+		"day": 24 * time.Hour, "d": 24 * time.Hour,
+		"week": 7 * 24 * time.Hour, "w": 7 * 24 * time.Hour,
+	}
+	var total time.Duration
+	i := 0
+	for i+1 < len(words) {
+		n, err := strconv.Atoi(words[i])
+		if err != nil {
+			if _, isNumber := strconv.Atoi(words[i+1]); strings.EqualFold(words[i], "and") && total > 0 && isNumber == nil {
+				i++
+				continue
+			}
+			break
+		}
+		unit, known := units[strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(words[i+1]), ","), "s")]
+		if !known {
+			unit, known = units[strings.TrimSuffix(strings.ToLower(words[i+1]), ",")]
+		}
+		if !known || n <= 0 {
+			break
+		}
+		total += time.Duration(n) * unit
+		i += 2
+	}
+	if total == 0 {
+		return 0, nil, fmt.Errorf("invalid duration %q", words[0])
+	}
+	return total, words[i:], nil
+}
+
+// parseClock reads a time of day like 17:00, 9:30, 5pm or 5:30pm
+func parseClock(s string) (hour, minute int, err error) {
+	for _, layout := range []string{"15:04", "3:04pm", "3pm", "3:04PM", "3PM"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Hour(), t.Minute(), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid time %q, use HH:MM", s)
+}
+
+// sendDueReminders sends reminders once they are due, for as long as the bot runs.
+// Reminders that came due while the bot was down are sent late with a note.
+func sendDueReminders(connection *Connection) {
+	ticker := time.NewTicker(reminderCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !connection.Connected() || connection.CurrentNick() == "" {
+			continue
+		}
+		due, err := connection.Network.Reminders.takeDue(connection.Network.Name, time.Now())
+		if err != nil {
+			color.Red(">> Error saving reminders: %v", err)
+		}
+		for _, reminder := range due {
+			sendReminder(connection, reminder)
+		}
+	}
+}
+
+// Function to send one reminder, by private message when the bot is not in its channel
+func sendReminder(connection *Connection, reminder Reminder) {
+	text := "Reminder: " + reminder.Text
+	if late := time.Since(reminder.DueAt); late > time.Minute {
+		text += fmt.Sprintf(" (late by %s)", FormatRoughDuration(late))
+	}
+
+	target := reminder.Target
+	if connection.Channels.IsChannel(target) && !connection.Channels.IsOn(target, connection.CurrentNick()) {
+		target = reminder.Creator
+	} else if reminder.Mention != "" && connection.Channels.IsChannel(target) {
+		text = reminder.Mention + ": " + text
+	}
+
+	color.Green(">> Sending reminder %d to %s", reminder.ID, target)
+	connection.SendLong(target, text)
+}
@@ -0,0 +1,117 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseReminderTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Saturday 2024-06-01 14:30 in Berlin
+	now := time.Date(2024, 6, 1, 14, 30, 0, 0, berlin)
+	local := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, berlin)
+	}
+
+	tests := []struct {
+		input string
+		loc   *time.Location
+		want  time.Time
+		rest  string
+	}{
+		{"in 2h30m call mom", berlin, now.Add(2*time.Hour + 30*time.Minute), "call mom"},
+		{"in 2 hours and 30 minutes call mom", berlin, now.Add(2*time.Hour + 30*time.Minute), "call mom"},
+		{"in 2 hours, 30 minutes call mom", berlin, now.Add(2*time.Hour + 30*time.Minute), "call mom"},
+		{"in 1 hour stretch", berlin, now.Add(time.Hour), "stretch"},
+		{"in 90 sec tea", berlin, now.Add(90 * time.Second), "tea"},
+		{"in 1d renew", berlin, now.Add(24 * time.Hour), "renew"},
+		{"in 1d2h renew", berlin, now.Add(26 * time.Hour), "renew"},
+		{"in 1 week and 2 days renew", berlin, now.Add(9 * 24 * time.Hour), "renew"},
+		{"in 5 minutes 10 pushups", berlin, now.Add(5 * time.Minute), "10 pushups"},
+		{"in 5 minutes and then some", berlin, now.Add(5 * time.Minute), "and then some"},
+		{"in 10m", berlin, now.Add(10 * time.Minute), ""},
+		{"at 17:00 standup", berlin, local(6, 1, 17, 0), "standup"},
+		{"at 5pm standup", berlin, local(6, 1, 17, 0), "standup"},
+		{"at 5:15PM standup", berlin, local(6, 1, 17, 15), "standup"},
+		{"at 9:00 standup", berlin, local(6, 2, 9, 0), "standup"},
+		{"at 14:30 now is not later", berlin, local(6, 2, 14, 30), "now is not later"},
+		{"at 2024-12-24 18:00 presents", berlin, local(12, 24, 18, 0), "presents"},
+		{"on 2024-12-24 at 18:00 presents", berlin, local(12, 24, 18, 0), "presents"},
+		{"on 2024-12-24 presents", berlin, local(12, 24, 9, 0), "presents"},
+		{"tomorrow at 9:00 dentist", berlin, local(6, 2, 9, 0), "dentist"},
+		{"Tomorrow AT 9am dentist", berlin, local(6, 2, 9, 0), "dentist"},
+		// 12:30 UTC is already 14:30 in Berlin, so 13:00 Berlin time has passed
+		{"at 13:00 lunch", berlin, local(6, 2, 13, 0), "lunch"},
+		{"at 13:00 lunch", time.UTC, time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC), "lunch"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			got, rest, err := ParseReminderTime(strings.Fields(test.input), now, test.loc)
+			if err != nil {
+				t.Fatalf("ParseReminderTime(%q): %v", test.input, err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("ParseReminderTime(%q) = %v, want %v", test.input, got, test.want)
+			}
+			if strings.Join(rest, " ") != test.rest {
+				t.Errorf("ParseReminderTime(%q) left %q, want %q", test.input, strings.Join(rest, " "), test.rest)
+			}
+		})
+	}
+}
+
+func TestParseReminderTimeDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The evening before the clocks go forward on 2024-03-31, a day that is 23 hours long
+	now := time.Date(2024, 3, 30, 20, 0, 0, 0, berlin)
+
+	tests := []struct {
+		input string
+		want  time.Time
+	}{
+		{"tomorrow at 9:00 x", time.Date(2024, 3, 31, 9, 0, 0, 0, berlin)},
+		{"at 9:00 x", time.Date(2024, 3, 31, 9, 0, 0, 0, berlin)},
+		{"in 24h x", time.Date(2024, 3, 31, 21, 0, 0, 0, berlin)},
+	}
+	for _, test := range tests {
+		got, _, err := ParseReminderTime(strings.Fields(test.input), now, berlin)
+		if err != nil {
+			t.Errorf("ParseReminderTime(%q): %v", test.input, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("ParseReminderTime(%q) = %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseReminderTimeErrors(t *testing.T) {
+	now := time.Date(2024, 6, 1, 14, 30, 0, 0, time.UTC)
+	for _, input := range []string{
+		"",
+		"soon",
+		"in",
+		"in a while",
+		"in 0 minutes",
+		"in -5 minutes",
+		"in 5 fortnights",
+		"at",
+		"at noon",
+		"at 25:00",
+		"tomorrow",
+		"tomorrow 9:00",
+		"tomorrow at lunch",
+	} {
+		if got, _, err := ParseReminderTime(strings.Fields(input), now, time.UTC); err == nil {
+			t.Errorf("ParseReminderTime(%q) = %v, want an error", input, got)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"mbot/config"
+
+	"github.com/ergochat/irc-go/ircmsg"
+	"github.com/fatih/color"
+)
+
+// saslTimeout bounds how long registration waits for SASL before going on without it
+const saslTimeout = 30 * time.Second
+
+// saslChunkSize is the longest AUTHENTICATE payload line
+const saslChunkSize = 400
+
+// saslConn holds back CAP END until SASL is done. ircevent ends capability negotiation
+// on its own and only knows SASL PLAIN, so the bot runs SASL itself beneath it.
+type saslConn struct {
+	net.Conn
+	mu      sync.Mutex
+	holding bool
+	ended   bool // CAP END was held back
+}
+
+// Write passes everything through except CAP END while it is held back
+func (c *saslConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.holding && string(bytes.TrimSpace(b)) == "CAP END" {
+		c.ended = true
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+// release stops holding back CAP END and sends it when ircevent already tried to
+func (c *saslConn) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.holding = false
+	if c.ended {
+		c.Conn.Write([]byte("CAP END\r\n"))
+	}
+}
+
+// saslSession logs the bot in while it connects, falling back to other mechanisms
+// and then to NickServ IDENTIFY when they fail
+type saslSession struct {
+	conn       *Connection
+	mechanisms []string // in the order they are tried
+	identify   bool     // identify to NickServ when SASL fails
+
+	mu         sync.Mutex
+	socket     *saslConn
+	timer      *time.Timer
+	remaining  []string
+	current    string
+	sawSASL    bool
+	advertised []string // mechanisms the server listed, empty when it did not say
+	failed     bool
+}
+
+// newSASLSession creates the SASL session of a connection, nil when the config does not use SASL
+func newSASLSession(conn *Connection, cfg *config.Config) *saslSession {
+	mechanism := cfg.SASLMechanism()
+	if mechanism == "" {
+		return nil
+	}
+	s := &saslSession{
+		conn:       conn,
+		mechanisms: []string{mechanism},
+		identify:   cfg.SASLFallback() != config.SASLFallbackNone && cfg.HasNickServPassword(),
+	}
+	if mechanism == config.SASLExternal && cfg.SASLFallback() == config.SASLFallbackPlain && cfg.HasNickServPassword() {
+		s.mechanisms = append(s.mechanisms, config.SASLPlain)
+	}
+	return s
+}
+
+// wrap starts a new session on a fresh connection
+func (s *saslSession) wrap(conn net.Conn) net.Conn {
+	socket := &saslConn{Conn: conn, holding: true}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.socket = socket
+	s.remaining = append([]string(nil), s.mechanisms...)
+	s.current = ""
+	s.sawSASL = false
+	s.advertised = nil
+	s.failed = false
+	s.timer = time.AfterFunc(saslTimeout, func() {
+		s.finish(false, "timed out")
+	})
+	return socket
+}
+
+// register adds the callbacks that drive the session
+func (s *saslSession) register() {
+	s.conn.Connection.AddCallback("CAP", s.handleCAP)
+	s.conn.Connection.AddCallback("AUTHENTICATE", s.handleAuthenticate)
+	s.conn.Connection.AddCallback(replyCodes["RPL_LOGGEDIN"], func(e ircmsg.Message) {
+		if len(e.Params) > 2 {
+			color.Green(">> Logged in as %s", e.Params[2])
+		}
+	})
+	s.conn.Connection.AddCallback(replyCodes["RPL_SASL_AUTH"], func(e ircmsg.Message) { s.finish(true, "") })
+	s.conn.Connection.AddCallback(replyCodes["ERR_SASL_AUTH"], func(e ircmsg.Message) { s.next("authentication failed") })
+	s.conn.Connection.AddCallback(replyCodes["ERR_SASLTOOLONG"], func(e ircmsg.Message) { s.next("message too long") })
+	s.conn.Connection.AddCallback(replyCodes["ERR_NICKLOCKED"], func(e ircmsg.Message) { s.finish(false, "the account is locked") })
+	s.conn.Connection.AddCallback(replyCodes["ERR_SASLABORTED"], func(e ircmsg.Message) { s.finish(false, "aborted") })
+	s.conn.Connection.AddCallback(replyCodes["ERR_SASLALREADY"], func(e ircmsg.Message) { s.finish(true, "") })
+	s.conn.Connection.AddCallback(replyCodes["RPL_SASLMECHS"], func(e ircmsg.Message) {
+		if len(e.Params) > 1 {
+			s.mu.Lock()
+			s.advertised = strings.Split(e.Params[1], ",")
+			s.mu.Unlock()
+		}
+	})
+}
+
+// handleCAP follows capability negotiation to start SASL once the server acknowledges it
+func (s *saslSession) handleCAP(e ircmsg.Message) {
+	if len(e.Params) < 3 {
+		return
+	}
+	capabilities := e.Params[len(e.Params)-1]
+	switch strings.ToUpper(e.Params[1]) {
+	case "LS":
+		s.mu.Lock()
+		for _, capability := range strings.Fields(capabilities) {
+			name, value, _ := strings.Cut(capability, "=")
+			if name == "sasl" {
+				s.sawSASL = true
+				if value != "" {
+					s.advertised = strings.Split(value, ",")
+				}
+			}
+		}
+		more := len(e.Params) > 3 && e.Params[2] == "*"
+		sawSASL := s.sawSASL
+		s.mu.Unlock()
+		if !more && !sawSASL {
+			s.finish(false, "the server does not support SASL")
+		}
+
+	case "ACK":
+		for _, capability := range strings.Fields(capabilities) {
+			if capability == "sasl" {
+				s.next("")
+			}
+		}
+
+	case "NAK":
+		for _, capability := range strings.Fields(capabilities) {
+			if capability == "sasl" {
+				s.finish(false, "the server refused the sasl capability")
+			}
+		}
+	}
+}
+
+// next tries the next mechanism the server supports, after the current one failed with the reason
+func (s *saslSession) next(reason string) {
+	s.mu.Lock()
+	if s.current != "" && reason != "" {
+		color.Red(">> SASL %s failed: %s", s.current, reason)
+	}
+	mechanism := ""
+	for len(s.remaining) > 0 && mechanism == "" {
+		candidate := s.remaining[0]
+		s.remaining = s.remaining[1:]
+		if len(s.advertised) == 0 || containsFold(s.advertised, candidate) {
+			mechanism = candidate
+		}
+	}
+	s.current = mechanism
+	s.mu.Unlock()
+
+	if mechanism == "" {
+		s.finish(false, "no mechanism left to try")
+		return
+	}
+	color.Yellow(">> Logging in with SASL %s", mechanism)
+	s.conn.Connection.Send("AUTHENTICATE", mechanism)
+}
+
+// handleAuthenticate answers the server's challenge for the current mechanism
+func (s *saslSession) handleAuthenticate(e ircmsg.Message) {
+	if len(e.Params) == 0 || e.Params[0] != "+" {
+		return
+	}
+	s.mu.Lock()
+	mechanism := s.current
+	s.mu.Unlock()
+
+	switch mechanism {
+	case config.SASLExternal:
+		// The certificate identifies the account, there is nothing else to send
+		s.conn.Connection.Send("AUTHENTICATE", "+")
+	case config.SASLPlain:
+		cfg := s.conn.Config
+		payload := base64.StdEncoding.EncodeToString([]byte(cfg.NickServUser + "\x00" + cfg.NickServUser + "\x00" + cfg.NickServPass))
+		for len(payload) >= saslChunkSize {
+			s.conn.Connection.Send("AUTHENTICATE", payload[:saslChunkSize])
+			payload = payload[saslChunkSize:]
+		}
+		if payload == "" {
+			payload = "+"
+		}
+		s.conn.Connection.Send("AUTHENTICATE", payload)
+	}
+}
+
+// finish ends the session and lets registration go on
+func (s *saslSession) finish(success bool, reason string) {
+	s.mu.Lock()
+	socket := s.socket
+	s.socket = nil
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if socket != nil {
+		s.failed = !success
+	}
+	s.mu.Unlock()
+	if socket == nil {
+		return
+	}
+
+	if success {
+		color.Green(">> SASL authentication successful")
+	} else {
+		color.Red(">> SASL authentication failed: %s", reason)
+	}
+	socket.release()
+}
+
+// needsIdentify reports whether the bot should identify to NickServ after SASL failed
+func (s *saslSession) needsIdentify() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failed && s.identify
+}
+
+// containsFold reports whether a list holds a value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
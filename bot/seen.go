@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Activities recorded by the seen tracker
+const (
+	SeenMessage = "message"
+	SeenAction  = "action"
+	SeenJoin    = "join"
+	SeenPart    = "part"
+	SeenQuit    = "quit"
+	SeenKick    = "kick"
+	SeenNick    = "nick"
+)
+
+// How often the seen tracker writes changes to disk
+const seenSaveInterval = time.Minute
+
+// SeenRecord is the last thing a nick was seen doing
+type SeenRecord struct {
+	Network string    `json:"network"`
+	Nick    string    `json:"nick"`
+	Account string    `json:"account,omitempty"`
+	Source  string    `json:"source,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	Action  string    `json:"action"`
+	Text    string    `json:"text,omitempty"`
+	NewNick string    `json:"new_nick,omitempty"`
+	Private bool      `json:"private,omitempty"` // the channel was secret or private at the time
+	Time    time.Time `json:"time"`
+}
+
+// seenData is the layout of the seen file
+type seenData struct {
+	Nicks    map[string]SeenRecord `json:"nicks"`
+	Accounts map[string]SeenRecord `json:"accounts"`
+}
+
+// SeenTracker remembers the last activity of every nick and account in the channels the bot is in.
+// Private messages are never recorded.
+type SeenTracker struct {
+	mu       sync.Mutex
+	filePath string
+	data     seenData
+	dirty    bool
+}
+
+// LoadSeenTracker loads the seen records from a file and saves changes to it every minute
+func LoadSeenTracker(filePath string) (*SeenTracker, error) {
+	t := &SeenTracker{filePath: filePath}
+	if err := loadJSON(filePath, &t.data); err != nil {
+		return nil, err
+	}
+	if t.data.Nicks == nil {
+		t.data.Nicks = make(map[string]SeenRecord)
+	}
+	if t.data.Accounts == nil {
+		t.data.Accounts = make(map[string]SeenRecord)
+	}
+
+	go func() {
+		for range time.Tick(seenSaveInterval) {
+			if err := t.Save(); err != nil {
+				color.Red(">> Error saving seen records: %v", err)
+			}
+		}
+	}()
+	return t, nil
+}
+
+// Record stores an activity of a nick, and of its account when it is logged in
+func (t *SeenTracker) Record(record SeenRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.data.Nicks[seenKey(record.Network, record.Nick)] = record
+	if record.Account != "" {
+		t.data.Accounts[seenKey(record.Network, record.Account)] = record
+	}
+	t.dirty = true
+}
+
+// Lookup finds the last activity of a nick, falling back to an account of that name.
+// Nicks with * and ? wildcards return every match, most recent first.
+func (t *SeenTracker) Lookup(network, nick string) []SeenRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !strings.ContainsAny(nick, "*?") {
+		if record, exists := t.data.Nicks[seenKey(network, nick)]; exists {
+			return []SeenRecord{record}
+		}
+		if record, exists := t.data.Accounts[seenKey(network, strings.TrimPrefix(nick, AccountKeyPrefix))]; exists {
+			return []SeenRecord{record}
+		}
+		return nil
+	}
+
+	var matches []SeenRecord
+	for _, record := range t.data.Nicks {
+		if record.Network == network && MatchMask(nick, record.Nick) {
+			matches = append(matches, record)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Time.After(matches[j].Time) })
+	return matches
+}
+
+// Save writes the seen records to disk if they changed
+func (t *SeenTracker) Save() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dirty {
+		return nil
+	}
+	if err := saveJSON(t.filePath, t.data); err != nil {
+		return err
+	}
+	t.dirty = false
+	return nil
+}
+
+// seenKey builds the key of a nick or account on a network
+func seenKey(network, name string) string {
+	return network + " " + strings.ToLower(name)
+}
+
+// recordSeen records an activity of the sender of an event
+func (c *Connection) recordSeen(source, channel, action, text, newNick string, at time.Time) {
+	nick := ExtractNickname(source)
+	if strings.EqualFold(nick, c.CurrentNick()) {
+		return
+	}
+	c.Network.Seen.Record(SeenRecord{
+		Network: c.Network.Name,
+		Nick:    nick,
+		Account: c.Accounts.Get(nick),
+		Source:  source,
+		Channel: channel,
+		Action:  action,
+		Text:    text,
+		NewNick: newNick,
+		Private: channel != "" && c.Channels.IsPrivate(channel),
+		Time:    at,
+	})
+}
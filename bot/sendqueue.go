@@ -0,0 +1,330 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"mbot/config"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+	"github.com/fatih/color"
+)
+
+// Default flood control settings used when the config does not set them
+const (
+	defaultSendBurst      = 5
+	defaultSendInterval   = time.Second
+	defaultSendMaxBacklog = 30
+	quitFlushTimeout      = 5 * time.Second
+)
+
+// ErrBacklogFull is returned when a target already has too many lines waiting
+var ErrBacklogFull = errors.New("send backlog full")
+
+// Priority decides which queued lines are sent first
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // Channel and private chatter
+	PriorityNormal                 // Joins, WHO/WHOIS and other commands
+	PriorityHigh                   // Mode changes, kicks and PONG replies
+	priorityCount
+)
+
+// Function to pick the priority of an outgoing command
+func priorityFor(command string) Priority {
+	switch strings.ToUpper(command) {
+	case "MODE", "KICK", "REMOVE", "PONG":
+		return PriorityHigh
+	case "PRIVMSG", "NOTICE", "TAGMSG":
+		return PriorityLow
+	default:
+		return PriorityNormal
+	}
+}
+
+// targetQueues holds the lines of one priority, with one queue per target
+// that is served round robin so a busy channel cannot starve the others.
+// Each entry is a group of lines that are sent back to back, usually a single line.
+type targetQueues struct {
+	order []string
+	lines map[string][][]ircmsg.Message
+}
+
+// pop takes one group from the target whose turn it is
+func (q *targetQueues) pop() ([]ircmsg.Message, bool) {
+	if len(q.order) == 0 {
+		return nil, false
+	}
+	target := q.order[0]
+	q.order = q.order[1:]
+
+	lines := q.lines[target]
+	msg := lines[0]
+	if len(lines) > 1 {
+		q.lines[target] = lines[1:]
+		q.order = append(q.order, target)
+	} else {
+		delete(q.lines, target)
+	}
+	return msg, true
+}
+
+// SendQueue rate limits everything the bot sends with a token bucket
+type SendQueue struct {
+	mu         sync.Mutex
+	irc        *ircevent.Connection
+	queues     [priorityCount]targetQueues
+	pending    int
+	tokens     float64
+	lastRefill time.Time
+	burst      float64
+	interval   time.Duration
+	maxBacklog int
+	wake       chan struct{}
+	sent       func(msg ircmsg.Message) // called for every line sent, set before anything is queued
+}
+
+// newSendQueue creates the outbound queue for a connection and starts sending from it
+func newSendQueue(irc *ircevent.Connection, cfg *config.Config) *SendQueue {
+	q := &SendQueue{
+		irc:        irc,
+		burst:      defaultSendBurst,
+		interval:   defaultSendInterval,
+		maxBacklog: defaultSendMaxBacklog,
+		wake:       make(chan struct{}, 1),
+	}
+	if cfg.SendQueue.Burst > 0 {
+		q.burst = float64(cfg.SendQueue.Burst)
+	}
+	if cfg.SendQueue.IntervalMillis > 0 {
+		q.interval = time.Duration(cfg.SendQueue.IntervalMillis) * time.Millisecond
+	}
+	if cfg.SendQueue.MaxBacklog > 0 {
+		q.maxBacklog = cfg.SendQueue.MaxBacklog
+	}
+	q.tokens = q.burst
+	q.lastRefill = time.Now()
+	for i := range q.queues {
+		q.queues[i].lines = make(map[string][][]ircmsg.Message)
+	}
+
+	go q.run()
+	return q
+}
+
+// Function to find the channel or nick a message is sent to, for fairness between targets
+func queueTarget(msg ircmsg.Message) string {
+	if len(msg.Params) > 0 {
+		switch strings.ToUpper(msg.Command) {
+		case "PRIVMSG", "NOTICE", "TAGMSG", "MODE", "KICK":
+			return strings.ToLower(msg.Params[0])
+		}
+	}
+	return ""
+}
+
+// Enqueue adds a message to the queue. Lines for a target with a full backlog are dropped.
+func (q *SendQueue) Enqueue(msg ircmsg.Message) error {
+	return q.enqueue(priorityFor(msg.Command), queueTarget(msg), []ircmsg.Message{msg})
+}
+
+// EnqueueGroup adds lines that must be sent back to back, such as a BATCH, for a target.
+// The group counts as one line against the target's backlog.
+func (q *SendQueue) EnqueueGroup(priority Priority, target string, msgs []ircmsg.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	return q.enqueue(priority, strings.ToLower(target), msgs)
+}
+
+// enqueue stores a group of lines and wakes up the sender
+func (q *SendQueue) enqueue(priority Priority, target string, msgs []ircmsg.Message) error {
+	q.mu.Lock()
+	queue := &q.queues[priority]
+	groups, exists := queue.lines[target]
+	if len(groups) >= q.maxBacklog {
+		q.mu.Unlock()
+		color.Yellow(">> Dropping %s to %s, %d lines already queued", msgs[0].Command, target, len(groups))
+		return ErrBacklogFull
+	}
+	if !exists {
+		queue.order = append(queue.order, target)
+	}
+	queue.lines[target] = append(groups, msgs)
+	q.pending++
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns the number of lines or groups waiting to be sent
+func (q *SendQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// Clear drops every queued line, used when the connection drops
+func (q *SendQueue) Clear() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.queues {
+		q.queues[i] = targetQueues{lines: make(map[string][][]ircmsg.Message)}
+	}
+	q.pending = 0
+	q.tokens = q.burst
+	q.lastRefill = time.Now()
+}
+
+// Flush waits until the queue is empty or the timeout has passed
+func (q *SendQueue) Flush(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for q.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// run sends queued lines for as long as the bot runs
+func (q *SendQueue) run() {
+	for {
+		if q.Pending() == 0 {
+			<-q.wake
+			continue
+		}
+		q.waitForToken()
+
+		// The next line is picked after waiting so a kick queued meanwhile goes first
+		group, ok := q.next()
+		if !ok {
+			continue
+		}
+		for i, msg := range group {
+			if i > 0 {
+				q.waitForToken()
+			}
+			if err := q.irc.SendIRCMessage(msg); err != nil {
+				color.Red(">> Failed to send %s: %v", msg.Command, err)
+			} else if q.sent != nil {
+				q.sent(msg)
+			}
+		}
+	}
+}
+
+// next takes the highest priority group that is waiting
+func (q *SendQueue) next() ([]ircmsg.Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := len(q.queues) - 1; i >= 0; i-- {
+		if group, ok := q.queues[i].pop(); ok {
+			q.pending--
+			return group, true
+		}
+	}
+	return nil, false
+}
+
+// waitForToken blocks until the token bucket allows another line and takes the token
+func (q *SendQueue) waitForToken() {
+	for {
+		q.mu.Lock()
+		now := time.Now()
+		q.tokens += float64(now.Sub(q.lastRefill)) / float64(q.interval)
+		if q.tokens > q.burst {
+			q.tokens = q.burst
+		}
+		q.lastRefill = now
+		if q.tokens >= 1 {
+			q.tokens--
+			q.mu.Unlock()
+			return
+		}
+		wait := time.Duration((1 - q.tokens) * float64(q.interval))
+		q.mu.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+// The methods below shadow the ircevent ones so everything the bot sends goes through its queue
+
+// Send queues an IRC message
+func (c *Connection) Send(command string, params ...string) error {
+	return c.Queue.Enqueue(ircmsg.MakeMessage(nil, "", command, params...))
+}
+
+// SendRaw queues a raw IRC line
+func (c *Connection) SendRaw(line string) error {
+	msg, err := ircmsg.ParseLine(line)
+	if err != nil {
+		return fmt.Errorf("error parsing line: %w", err)
+	}
+	return c.Queue.Enqueue(msg)
+}
+
+// Privmsg queues a message to a channel or nick
+func (c *Connection) Privmsg(target, message string) error {
+	return c.Send("PRIVMSG", target, message)
+}
+
+// Privmsgf queues a formatted message to a channel or nick
+func (c *Connection) Privmsgf(target, format string, a ...interface{}) error {
+	return c.Privmsg(target, fmt.Sprintf(format, a...))
+}
+
+// Notice queues a notice to a channel or nick
+func (c *Connection) Notice(target, message string) error {
+	return c.Send("NOTICE", target, message)
+}
+
+// Noticef queues a formatted notice to a channel or nick
+func (c *Connection) Noticef(target, format string, a ...interface{}) error {
+	return c.Notice(target, fmt.Sprintf(format, a...))
+}
+
+// Action queues a CTCP ACTION to a channel or nick
+func (c *Connection) Action(target, message string) error {
+	return c.Privmsg(target, fmt.Sprintf("\001ACTION %s\001", message))
+}
+
+// Actionf queues a formatted CTCP ACTION to a channel or nick
+func (c *Connection) Actionf(target, format string, a ...interface{}) error {
+	return c.Action(target, fmt.Sprintf(format, a...))
+}
+
+// Join queues a JOIN for a channel, with its key when one was saved by !join or is in the config
+func (c *Connection) Join(channel string) error {
+	if key := c.channelKey(channel); key != "" {
+		return c.Send("JOIN", channel, key)
+	}
+	return c.Send("JOIN", channel)
+}
+
+// channelKey returns the key the bot uses to join a channel
+func (c *Connection) channelKey(channel string) string {
+	if c.Network != nil && c.Network.Joined != nil {
+		if key := c.Network.Joined.Key(c.Network.Name, channel); key != "" {
+			return key
+		}
+	}
+	return c.Config.Channel(channel).Key
+}
+
+// Part queues a PART for a channel
+func (c *Connection) Part(channel string) error {
+	return c.Send("PART", channel)
+}
+
+// Quit sends what is still queued, waiting a few seconds at most, and disconnects
+func (c *Connection) Quit() {
+	c.Queue.Flush(quitFlushTimeout)
+	c.Connection.Quit()
+}
@@ -0,0 +1,220 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	// maxLineBytes is the IRC line limit, including the trailing CRLF
+	maxLineBytes = 512
+
+	// Worst case length of user@host while the bot does not know its own yet:
+	// a 10 character username and a 63 character host
+	unknownUserHostLength = 10 + 1 + 63
+
+	multilineCap       = "draft/multiline"
+	multilineConcatTag = "draft/multiline-concat"
+)
+
+var multilineBatchID atomic.Uint64
+
+// ownHostmask remembers the user@host the server shows for the bot
+type ownHostmask struct {
+	mu       sync.Mutex
+	userHost string
+}
+
+// setOwnUserHost stores the bot's user@host, taken from its own JOIN or the welcome message
+func (c *Connection) setOwnUserHost(userHost string) {
+	if !strings.Contains(userHost, "@") {
+		return
+	}
+	c.hostmask.mu.Lock()
+	c.hostmask.userHost = userHost
+	c.hostmask.mu.Unlock()
+}
+
+// setOwnHost replaces the host part after the server hides or changes it
+func (c *Connection) setOwnHost(host string) {
+	c.hostmask.mu.Lock()
+	defer c.hostmask.mu.Unlock()
+	if user, _, found := strings.Cut(c.hostmask.userHost, "@"); found {
+		c.hostmask.userHost = user + "@" + host
+	}
+}
+
+// OwnHostmask returns the bot's nick!user@host, or only the nick while user@host is unknown
+func (c *Connection) OwnHostmask() string {
+	c.hostmask.mu.Lock()
+	defer c.hostmask.mu.Unlock()
+	if c.hostmask.userHost == "" {
+		return c.CurrentNick()
+	}
+	return c.CurrentNick() + "!" + c.hostmask.userHost
+}
+
+// LineBudget returns how many bytes of text fit in one command to a target once the
+// server has added the :nick!user@host prefix, so relayed lines are never cut off
+func (c *Connection) LineBudget(command, target string) int {
+	source := c.OwnHostmask()
+	if !strings.Contains(source, "!") {
+		source += "!" + strings.Repeat("x", unknownUserHostLength)
+	}
+	// :source COMMAND target :text\r\n
+	overhead := 1 + len(source) + 1 + len(command) + 1 + len(target) + 2 + 2
+	return maxLineBytes - overhead
+}
+
+// SplitMessage splits text into lines that fit in a PRIVMSG to the target
+func (c *Connection) SplitMessage(target, text string) []string {
+	return SplitText(text, c.LineBudget("PRIVMSG", target))
+}
+
+// SendLong sends text that may be longer than one line or contain newlines. The lines
+// are sent as one draft/multiline batch when the server supports it.
+func (c *Connection) SendLong(target, text string) error {
+	budget := c.LineBudget("PRIVMSG", target)
+
+	if maxBytes, maxLines, supported := c.multilineLimits(); supported {
+		// One byte is kept free for the space that joins wrapped lines back together
+		chunks := splitChunks(text, budget-1)
+		if len(chunks) > 1 {
+			return c.sendMultiline(target, chunks, maxBytes, maxLines)
+		}
+	}
+
+	for _, line := range SplitText(text, budget) {
+		if err := c.Privmsg(target, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// multilineLimits returns the limits of the draft/multiline capability, if it was acknowledged
+func (c *Connection) multilineLimits() (maxBytes, maxLines int, supported bool) {
+	value, supported := c.AcknowledgedCaps()[multilineCap]
+	if !supported {
+		return 0, 0, false
+	}
+	for _, option := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(option, "=")
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "max-bytes":
+			maxBytes = n
+		case "max-lines":
+			maxLines = n
+		}
+	}
+	return maxBytes, maxLines, maxBytes > 0
+}
+
+// sendMultiline sends chunks as draft/multiline batches, starting a new batch whenever a limit is reached
+func (c *Connection) sendMultiline(target string, chunks []textChunk, maxBytes, maxLines int) error {
+	for len(chunks) > 0 {
+		id := fmt.Sprintf("ml%d", multilineBatchID.Add(1))
+		msgs := []ircmsg.Message{ircmsg.MakeMessage(nil, "", "BATCH", "+"+id, multilineCap, target)}
+
+		size := 0
+		count := 0
+		for count < len(chunks) {
+			chunk := chunks[count]
+			text := chunk.text
+			if chunk.spaced {
+				text += " "
+			}
+			if count > 0 && (size+len(text)+1 > maxBytes || (maxLines > 0 && count >= maxLines)) {
+				break
+			}
+
+			msg := ircmsg.MakeMessage(nil, "", "PRIVMSG", target, text)
+			msg.SetTag("batch", id)
+			if count > 0 && chunks[count-1].continues {
+				msg.SetTag(multilineConcatTag, "")
+			}
+			msgs = append(msgs, msg)
+			size += len(text) + 1
+			count++
+		}
+		// The joining space is not needed when a batch ends in the middle of a paragraph
+		if last := &msgs[len(msgs)-1]; chunks[count-1].spaced {
+			last.Params[1] = strings.TrimSuffix(last.Params[1], " ")
+		}
+
+		msgs = append(msgs, ircmsg.MakeMessage(nil, "", "BATCH", "-"+id))
+		if err := c.Queue.EnqueueGroup(PriorityLow, target, msgs); err != nil {
+			return err
+		}
+		chunks = chunks[count:]
+	}
+	return nil
+}
+
+// textChunk is one line of split text. Lines that continue the same paragraph on the
+// next line are marked, together with whether they were broken at a space.
+type textChunk struct {
+	text      string
+	continues bool
+	spaced    bool
+}
+
+// SplitText splits text into lines of at most budget bytes. It breaks at newlines and
+// between words, and only inside a word when the word alone is too long, never inside
+// a UTF-8 character.
+func SplitText(text string, budget int) []string {
+	chunks := splitChunks(text, budget)
+	lines := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		lines[i] = chunk.text
+	}
+	return lines
+}
+
+// splitChunks does the work for SplitText and remembers where lines were wrapped
+func splitChunks(text string, budget int) []textChunk {
+	if budget < utf8.UTFMax {
+		budget = utf8.UTFMax
+	}
+
+	var chunks []textChunk
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			continue
+		}
+
+		line := ""
+		for _, word := range words {
+			if line != "" && len(line)+1+len(word) <= budget {
+				line += " " + word
+				continue
+			}
+			if line != "" {
+				chunks = append(chunks, textChunk{text: line, continues: true, spaced: true})
+			}
+			// Words longer than a line are cut at the last rune that fits
+			for len(word) > budget {
+				cut := budget
+				for cut > 0 && !utf8.RuneStart(word[cut]) {
+					cut--
+				}
+				chunks = append(chunks, textChunk{text: word[:cut], continues: true})
+				word = word[cut:]
+			}
+			line = word
+		}
+		chunks = append(chunks, textChunk{text: line})
+	}
+	return chunks
+}
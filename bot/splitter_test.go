@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		budget int
+		want   []string
+	}{
+		{"empty", "", 10, []string{}},
+		{"only spaces", "   \n  ", 10, []string{}},
+		{"fits", "hello world", 20, []string{"hello world"}},
+		{"exactly the budget", "hello world", 11, []string{"hello world"}},
+		{"breaks between words", "hello world", 10, []string{"hello", "world"}},
+		{"collapses spaces", "a   b \t c", 20, []string{"a b c"}},
+		{"fills lines", "aa bb cc dd ee", 5, []string{"aa bb", "cc dd", "ee"}},
+		{"newlines", "one\ntwo\r\nthree", 20, []string{"one", "two", "three"}},
+		{"skips empty lines", "one\n\n\ntwo", 20, []string{"one", "two"}},
+		{"cuts long words", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"long word after a short one", "hi abcdefghij", 4, []string{"hi", "abcd", "efgh", "ij"}},
+		{"words after a cut", "abcdef gh", 4, []string{"abcd", "ef", "gh"}},
+		{"never inside a rune", "ééééé", 5, []string{"éé", "éé", "é"}},
+		{"four byte runes", "😀😀😀", 5, []string{"😀", "😀", "😀"}},
+		{"tiny budgets still fit a rune", "😀😀", 1, []string{"😀", "😀"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := SplitText(test.text, test.budget)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("SplitText(%q, %d) = %q, want %q", test.text, test.budget, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSplitTextKeepsEverything(t *testing.T) {
+	text := strings.Repeat("Grüße aus Köln, 東京 und überall 😀 ", 40)
+	for budget := utf8.UTFMax; budget <= 64; budget++ {
+		lines := SplitText(text, budget)
+		for _, line := range lines {
+			if len(line) > budget {
+				t.Fatalf("budget %d: line %q is %d bytes", budget, line, len(line))
+			}
+			if !utf8.ValidString(line) {
+				t.Fatalf("budget %d: line %q is not valid UTF-8", budget, line)
+			}
+		}
+		if got, want := strings.ReplaceAll(strings.Join(lines, ""), " ", ""), strings.ReplaceAll(text, " ", ""); got != want {
+			t.Fatalf("budget %d: text changed after splitting", budget)
+		}
+	}
+}
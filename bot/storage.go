@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// loadJSON reads a JSON data file into v. A missing file leaves v untouched.
+func loadJSON(filePath string, v interface{}) error {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error opening %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(v); err != nil {
+		return fmt.Errorf("error decoding %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// saveJSON writes v to a JSON data file. It writes a temporary file first so a
+// crash halfway through never leaves a truncated file behind.
+func saveJSON(filePath string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return fmt.Errorf("error creating directory for %s: %w", filePath, err)
+	}
+
+	tmpPath := filePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", tmpPath, err)
+	}
+
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		file.Close()
+		return fmt.Errorf("error encoding %s: %w", filePath, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", tmpPath, err)
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return fmt.Errorf("error replacing %s: %w", filePath, err)
+	}
+	return nil
+}
@@ -8,8 +8,6 @@ import (
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/ergochat/irc-go/ircevent"
 )
 
 type UserScores struct {
@@ -77,7 +75,7 @@ func checkTriviaAnswer(sender, message, target string, connection *Connection) {
 		ScoresInstance.Mu.Unlock()
 
 		// Save the updated scores
-		if err := SaveScores("./data/trivia_scores.json"); err != nil {
+		if err := SaveScores(DataPath(TriviaScoresFile)); err != nil {
 			connection.Privmsg(target, "Error saving scores: "+err.Error())
 		}
 	} else {
@@ -86,7 +84,7 @@ func checkTriviaAnswer(sender, message, target string, connection *Connection) {
 	}
 }
 
-func StartTriviaTimer(connection *ircevent.Connection, target string) {
+func StartTriviaTimer(connection *Connection, target string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	TriviaStateInstance.Mu.Lock()
 	TriviaStateInstance.CancelFunc = cancel
@@ -2,7 +2,6 @@ package url_features
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"mime"
 	"net/http"
@@ -16,9 +15,6 @@ import (
 func FetchTitle(url string) (string, error) {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
 	}
 
 	resp, err := client.Get(url)
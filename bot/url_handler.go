@@ -3,20 +3,15 @@ package bot
 import (
 	"fmt"
 	"mbot/bot/url_features"
-	"mbot/config"
 	"os"
 	"strings"
 
-	"github.com/ergochat/irc-go/ircevent"
 	"github.com/fatih/color"
 )
 
-// Global variable to hold the URL configuration
-var URLConfigData *config.URLFeatures
-
 // HandleUrl processes URLs found in messages
 func HandleUrl(connection *Connection, sender, target, url string) {
-	featureConfig := URLConfigData
+	featureConfig := connection.Network.URLConfig
 
 	switch {
 	case strings.Contains(url, "youtube.com"), strings.Contains(url, "youtu.be"):
@@ -44,7 +39,7 @@ func HandleUrl(connection *Connection, sender, target, url string) {
 			color.Red(">> IMDb link handling is disabled")
 		}
 	default:
-		GetTitle(connection.Connection, target, url)
+		GetTitle(connection, target, url)
 		if featureConfig.EnableVirusTotalCheck {
 			HandleVirusTotalLink(connection, sender, target, url)
 		} else {
@@ -54,12 +49,12 @@ func HandleUrl(connection *Connection, sender, target, url string) {
 }
 
 // Function to get url title
-func GetTitle(connection *ircevent.Connection, target, url string) {
+func GetTitle(connection *Connection, target, url string) {
 	title, err := url_features.FetchTitle(url)
 	if err != nil || title == "" {
 		color.Red(">> Error fetching title if <nil>: %v the page does not have a title", err)
 	} else {
-		connection.Privmsg(target, "^ "+title)
+		connection.SendLong(target, "^ "+title)
 	}
 }
 
@@ -78,7 +73,7 @@ func HandleYoutubeLink(connection *Connection, target, url string) {
 		color.Red(">> Error getting video info: %v", err)
 		connection.Privmsg(target, "Error getting video info.")
 	} else {
-		connection.Privmsg(target, videoInfo)
+		connection.SendLong(target, videoInfo)
 	}
 }
 
@@ -94,7 +89,7 @@ func HandleGithubLink(connection *Connection, target, url string) {
 		color.Red(">> Error fetching GitHub repository info: %v", err)
 		connection.Privmsg(target, "Error fetching GitHub repository info.")
 	} else {
-		connection.Privmsg(target, info)
+		connection.SendLong(target, info)
 	}
 }
 
@@ -119,7 +114,7 @@ func HandleIMDbLink(connection *Connection, target, url string) {
 		color.Red(">> Error fetching IMDb movie info: %v", err)
 		connection.Privmsg(target, "Error fetching IMDb movie info.")
 	} else {
-		connection.Privmsg(target, info)
+		connection.SendLong(target, info)
 	}
 }
 
@@ -142,7 +137,7 @@ func HandleVirusTotalLink(connection *Connection, sender, target, url string) {
 			// show just part of the url to avoid people clicking on it
 			url = url_features.ShortenURL(url)
 
-			connection.Privmsg(target, fmt.Sprintf("⚠️ %s just pasted a link that triggered my automatic defense systems ☢️ %s [Full url hidden] ☢️ Here is a VirusTotal report: %s Note: low malicious score may be false positive", nick, url, reportMessage))
+			connection.SendLong(target, fmt.Sprintf("⚠️ %s just pasted a link that triggered my automatic defense systems ☢️ %s [Full url hidden] ☢️ Here is a VirusTotal report: %s Note: low malicious score may be false positive", nick, url, reportMessage))
 		} else {
 			color.Green(">> URL is safe: %s", url)
 		}
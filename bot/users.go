@@ -3,14 +3,18 @@ package bot
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
+	"mbot/config"
+
 	"github.com/ergochat/irc-go/ircevent"
 	"github.com/ergochat/irc-go/ircmsg"
 	"github.com/fatih/color"
@@ -34,17 +38,90 @@ const (
 	RoleOwner    = 10
 )
 
-// global users map
-var Users map[string]User
+// RoleNames returns the role names from the highest role to the lowest
+func RoleNames() []string {
+	names := make([]string, 0, len(UserRoles))
+	for name := range UserRoles {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return UserRoles[names[i]] > UserRoles[names[j]] })
+	return names
+}
+
+// FindRole returns the role with the given name, ignoring case, as it is spelled in UserRoles
+func FindRole(name string) (string, bool) {
+	for role := range UserRoles {
+		if strings.EqualFold(role, name) {
+			return role, true
+		}
+	}
+	return "", false
+}
+
+// AccountKeyPrefix marks users that are identified by their services account
+const AccountKeyPrefix = "$a:"
 
 // Structure to represent a user
 type User struct {
-	Hostmask string            `json:"hostmask"`
-	Roles    map[string]string `json:"roles"` // map of channel to role
+	Hostmask string            `json:"hostmask,omitempty"`
+	Account  string            `json:"account,omitempty"` // NickServ account, preferred over the hostmask
+	Masks    []string          `json:"masks,omitempty"`   // nick!user@host masks with * and ? wildcards
+	Roles    map[string]string `json:"roles"`             // map of channel to role
 }
 
-// Path to the users JSON file
-var filePath = "./data/users.json"
+// Key returns the key the user is stored under in users.json
+func (u User) Key() string {
+	if u.Account != "" {
+		return AccountKeyPrefix + strings.ToLower(u.Account)
+	}
+	if u.Hostmask == "" && len(u.Masks) > 0 {
+		return u.Masks[0]
+	}
+	return u.Hostmask
+}
+
+// AddMask adds a mask to the user, returning false if it is already there
+func (u *User) AddMask(mask string) bool {
+	for _, existing := range u.Masks {
+		if strings.EqualFold(existing, mask) {
+			return false
+		}
+	}
+	u.Masks = append(u.Masks, mask)
+	return true
+}
+
+// RemoveMask removes a mask from the user, returning false if it was not there
+func (u *User) RemoveMask(mask string) bool {
+	for i, existing := range u.Masks {
+		if strings.EqualFold(existing, mask) {
+			// Build a new slice so copies of the user stored in the map are left untouched
+			masks := make([]string, 0, len(u.Masks)-1)
+			masks = append(masks, u.Masks[:i]...)
+			u.Masks = append(masks, u.Masks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// matchSpecificity returns how specifically the user matches a source, or -1 if it does not match
+func (u User) matchSpecificity(source string) int {
+	best := -1
+	if u.Hostmask != "" && NormalizeHostmask(u.Hostmask) == NormalizeHostmask(ExtractHostmask(source)) {
+		// An exact hostmask is as specific as the equivalent *!user@host mask
+		best = maskSpecificity(u.Hostmask)
+	}
+	target := sourceToMaskTarget(source)
+	for _, mask := range u.Masks {
+		if MatchMask(mask, target) {
+			if score := maskSpecificity(mask); score > best {
+				best = score
+			}
+		}
+	}
+	return best
+}
 
 // Mutex to protect access to the owner setup process
 var ownerPromptMutex sync.Mutex
@@ -81,17 +158,23 @@ func LoadUsers(filePath string) (map[string]User, error) {
 	}
 	defer file.Close()
 
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading users file: %w", err)
+	}
 	var users map[string]User
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&users); err != nil {
-		return nil, fmt.Errorf("error decoding users file: %w", err)
+	if err := config.DecodeFile(filePath, data, &users); err != nil {
+		return nil, err
+	}
+	if err := validateUsers(users, filePath); err != nil {
+		return nil, err
 	}
 
 	return users, nil
 }
 
 // Function to save users to a JSON file
-func SaveUsers(users map[string]User) error {
+func SaveUsers(users map[string]User, filePath string) error {
 	file, err := os.Create(filePath)
 	if err != nil {
 		return fmt.Errorf("error creating users file: %w", err)
@@ -108,30 +191,30 @@ func SaveUsers(users map[string]User) error {
 }
 
 // Function to add a user to the list of users
-func AddUser(users map[string]User, user User) error {
-	users[user.Hostmask] = user
-	return SaveUsers(users)
+func AddUser(users map[string]User, user User, filePath string) error {
+	users[user.Key()] = user
+	return SaveUsers(users, filePath)
 }
 
 // Function to remove a user from the list of users
-func RemoveUser(users map[string]User, hostmask string) error {
-	delete(users, hostmask)
-	return SaveUsers(users)
+func RemoveUser(users map[string]User, key string, filePath string) error {
+	delete(users, key)
+	return SaveUsers(users, filePath)
 }
 
 // Function to get a list of users
 func GetUserList(users map[string]User) string {
 	userList := ""
-	for hostmask := range users {
-		userList += hostmask + " "
+	for key := range users {
+		userList += key + " "
 	}
 	return userList
 }
 
 // Function to update a user in the list of users
-func UpdateUser(users map[string]User, user User) error {
-	users[user.Hostmask] = user
-	return SaveUsers(users)
+func UpdateUser(users map[string]User, user User, filePath string) error {
+	users[user.Key()] = user
+	return SaveUsers(users, filePath)
 }
 
 // Normalize the hostmask to ensure consistent format
@@ -142,26 +225,83 @@ func NormalizeHostmask(hostmask string) string {
 	return hostmask
 }
 
-// Check if a user has a specific role in a channel
-func GetUserRole(users map[string]User, hostmask, channel string) string {
-	normalizedHostmask := NormalizeHostmask(hostmask)
+// FindUser returns the user logged in to the given services account.
+// If there is none it falls back to the user whose hostmask or masks match the source
+// (nick!user@host or user@host) most specifically. Ties go to the lowest key.
+func FindUser(users map[string]User, account, source string) (User, bool) {
+	if account != "" {
+		if user, exists := users[AccountKeyPrefix+strings.ToLower(account)]; exists {
+			return user, true
+		}
+	}
+
+	if source == "" {
+		return User{}, false
+	}
+	var found User
+	var foundKey string
+	best := -1
+	for key, user := range users {
+		score := user.matchSpecificity(source)
+		if score < 0 {
+			continue
+		}
+		if score > best || (score == best && key < foundKey) {
+			found, foundKey, best = user, key, score
+		}
+	}
+	return found, best >= 0
+}
+
+// LookupUser finds a user by the name used in commands: its key in users.json,
+// its account as $a:account, its hostmask or one of its masks
+func LookupUser(users map[string]User, identity string) (User, bool) {
+	if user, exists := users[identity]; exists {
+		return user, true
+	}
+	if account, isAccount := strings.CutPrefix(identity, AccountKeyPrefix); isAccount {
+		user, exists := users[AccountKeyPrefix+strings.ToLower(account)]
+		return user, exists
+	}
 	for _, user := range users {
-		if user.Hostmask == normalizedHostmask {
-			if user.Roles["*"] == "Owner" {
-				return "Owner"
-			}
-			if role, exists := user.Roles[channel]; exists {
-				return role
+		if user.Hostmask != "" && NormalizeHostmask(user.Hostmask) == NormalizeHostmask(identity) {
+			return user, true
+		}
+		for _, mask := range user.Masks {
+			if strings.EqualFold(mask, identity) {
+				return user, true
 			}
 		}
 	}
+	return User{}, false
+}
+
+// Check if a user has a specific role in a channel
+func GetUserRole(users map[string]User, hostmask, channel string) string {
+	return GetUserRoleByAccount(users, "", hostmask, channel)
+}
+
+// Check the role of a user identified by services account or source mask in a channel
+func GetUserRoleByAccount(users map[string]User, account, source, channel string) string {
+	if user, exists := FindUser(users, account, source); exists {
+		if user.Roles["*"] == "Owner" {
+			return "Owner"
+		}
+		if role, exists := user.Roles[channel]; exists {
+			return role
+		}
+	}
 	return "Everyone" // Default role if not found
 }
 
 // Function to get the role level of a user in a channel
 func GetUserRoleLevel(users map[string]User, hostmask, channel string) int {
-	normalizedHostmask := NormalizeHostmask(hostmask)
-	role := GetUserRole(users, normalizedHostmask, channel)
+	return GetUserRoleLevelByAccount(users, "", hostmask, channel)
+}
+
+// Function to get the role level of a user identified by services account or source mask in a channel
+func GetUserRoleLevelByAccount(users map[string]User, account, source, channel string) int {
+	role := GetUserRoleByAccount(users, account, source, channel)
 	return UserRoles[role]
 }
 
@@ -214,6 +354,7 @@ func AddOwnerPrompt(conn *Connection, users map[string]User) {
 
 			owner := User{
 				Hostmask: hostmask,
+				Account:  conn.Accounts.Get(ownerNick),
 				Roles:    map[string]string{"*": "Owner"},
 			}
 
@@ -232,7 +373,7 @@ func AddOwnerPrompt(conn *Connection, users map[string]User) {
 					conn.Privmsg(ownerNick, "If you don't run the setup, no other commands will work except for the !managecmd command.")
 
 					ownerPromptMutex.Lock()
-					err := AddUser(users, owner)
+					err := AddUser(users, owner, conn.Network.UsersPath())
 					ownerPromptMutex.Unlock()
 
 					if err != nil {
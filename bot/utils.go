@@ -2,7 +2,6 @@ package bot
 
 import (
 	"bytes"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,15 +13,27 @@ import (
 
 	"mbot/config"
 
-	"github.com/ergochat/irc-go/ircevent"
 	"github.com/fatih/color"
 	"github.com/joho/godotenv"
 )
 
-// Function to gracefully shutdown the bot
-func ShutdownBot(connection *ircevent.Connection) {
+// Function to gracefully shutdown the bot, quitting every network it is connected to
+func ShutdownBot(connection *Connection) {
 	color.Red("Shutting down bot...")
+	for _, conn := range Connections() {
+		if err := conn.Network.Seen.Save(); err != nil {
+			color.Red(">> Error saving seen records: %v", err)
+		}
+		if err := conn.Network.JoinPolicies.Save(); err != nil {
+			color.Red(">> Error saving join policies: %v", err)
+		}
+	}
 	connection.Quit()
+	for _, conn := range Connections() {
+		if conn != connection {
+			conn.Quit()
+		}
+	}
 	os.Exit(0)
 }
 
@@ -49,8 +60,12 @@ func ExtractHostmask(sender string) string {
 	return sender
 }
 
-// GetBotNickname retrieves the bot's current nickname
-func GetBotNickname(connection *ircevent.Connection) string {
+// GetBotNickname retrieves the nickname the bot is actually using, which can be an
+// alternate one while the configured nick is taken
+func GetBotNickname(connection *Connection) string {
+	if nick := connection.CurrentNick(); nick != "" {
+		return nick
+	}
 	return connection.Nick
 }
 
@@ -61,23 +76,6 @@ func FindURLs(message string) []string {
 	return re.FindAllString(message, -1)
 }
 
-// SplitMessage splits a message into chunks based on the max length
-func SplitMessage(message string, maxLength int) []string {
-	var chunks []string
-
-	for len(message) > maxLength {
-		cutIndex := strings.LastIndex(message[:maxLength], " ")
-		if cutIndex == -1 {
-			cutIndex = maxLength
-		}
-		chunks = append(chunks, message[:cutIndex])
-		message = message[cutIndex:]
-	}
-
-	chunks = append(chunks, message)
-	return chunks
-}
-
 // LoadEnv loads environment variables from the .env file
 func LoadEnv() {
 	if err := godotenv.Load(); err != nil {
@@ -131,12 +129,8 @@ func PasteService(content string) (string, error) {
 		return "", fmt.Errorf("error marshaling request data: %v", err)
 	}
 
-	// Create an HTTP client with TLS configuration to skip verification
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	// The default transport verifies certificates with the TLS settings from the config
+	client := &http.Client{Timeout: 30 * time.Second}
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
 	if err != nil {
@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+
+	"mbot/config"
+)
+
+// ValidateConfig checks the settings of the config that name roles and other values defined by the bot.
+// config.LoadConfig has already checked the rest.
+func ValidateConfig(cfg *config.Config, file string) error {
+	var problems config.Problems
+	for i, network := range cfg.NetworkConfigs() {
+		path := ""
+		if len(cfg.Networks) > 0 {
+			path = config.IndexPath("networks", i)
+		}
+		validateNetworkValues(network, file, path, &problems)
+	}
+	return problems.Err()
+}
+
+// validateNetworkValues checks the enumerated values of one network
+func validateNetworkValues(cfg *config.Config, file, path string, problems *config.Problems) {
+	checkChoice(problems, file, config.KeyPath(path, "nick_recovery.method"), cfg.NickRecovery.Method,
+		NickRecoveryRegain, NickRecoveryGhost, NickRecoveryNone)
+	checkChoice(problems, file, config.KeyPath(path, "bans.mask_style"), cfg.Bans.MaskStyle,
+		BanMaskHost, BanMaskUserHost, BanMaskNick, BanMaskFull)
+	checkChoice(problems, file, config.KeyPath(path, "invites.others"), cfg.Invites.Others,
+		InvitesQueue, InvitesIgnore)
+	for i, action := range cfg.Protection.Actions {
+		checkChoice(problems, file, config.IndexPath(config.KeyPath(path, "protection.actions"), i), action,
+			ActionWarn, ActionQuiet, ActionKick, ActionBan)
+	}
+	if len(cfg.Protection.QuietMode) > 1 {
+		problems.Add(file, config.KeyPath(path, "protection.quiet_mode"), "%q is not a single mode letter", cfg.Protection.QuietMode)
+	}
+	if cfg.Protection.ExemptRole != "" {
+		checkRole(problems, file, config.KeyPath(path, "protection.exempt_role"), cfg.Protection.ExemptRole)
+	}
+	if cfg.Invites.AcceptRole != "" {
+		checkRole(problems, file, config.KeyPath(path, "invites.accept_role"), cfg.Invites.AcceptRole)
+	}
+}
+
+// checkChoice reports a value that is set but is none of the allowed ones. Values are case sensitive,
+// since ban masks and protection actions are compared exactly.
+func checkChoice(problems *config.Problems, file, path, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+	for _, choice := range allowed {
+		if value == choice {
+			return
+		}
+	}
+	for _, choice := range allowed {
+		if strings.EqualFold(value, choice) {
+			problems.Add(file, path, "unknown value %q, did you mean %q?", value, choice)
+			return
+		}
+	}
+	problems.Add(file, path, "unknown value %q, use one of %s", value, strings.Join(allowed, ", "))
+}
+
+// checkRole reports a role name that does not exist. Roles are case sensitive.
+func checkRole(problems *config.Problems, file, path, role string) {
+	if _, exists := UserRoles[role]; exists {
+		return
+	}
+	if name, found := FindRole(role); found {
+		problems.Add(file, path, "unknown role %q, did you mean %q?", role, name)
+		return
+	}
+	problems.Add(file, path, "unknown role %q, use one of %s", role, strings.Join(RoleNames(), ", "))
+}
+
+// validateCommandConfig checks the roles in the command permissions along with the rest of the file
+func validateCommandConfig(cmdCfg *config.CommandConfig, file string) error {
+	problems := cmdCfg.Validate(file)
+	for command, permissions := range cmdCfg.Commands {
+		for i, permission := range permissions {
+			checkRole(&problems, file, config.KeyPath(config.IndexPath(config.MapKeyPath("commands", command), i), "role"), permission.Role)
+		}
+	}
+	sortProblems(problems)
+	return problems.Err()
+}
+
+// validateUsers checks the masks, channels and roles of the users file
+func validateUsers(users map[string]User, file string) error {
+	var problems config.Problems
+	for key, user := range users {
+		path := config.MapKeyPath("", key)
+		if user.Hostmask == "" && user.Account == "" && len(user.Masks) == 0 {
+			problems.Add(file, path, "needs a hostmask, an account or masks")
+		}
+		if user.Account != "" && key != user.Key() {
+			problems.Add(file, path, "users with an account are stored under %q", user.Key())
+		}
+		if user.Hostmask != "" && !strings.Contains(user.Hostmask, "@") {
+			problems.Add(file, config.KeyPath(path, "hostmask"), "%q is not a user@host hostmask", user.Hostmask)
+		}
+		for i, mask := range user.Masks {
+			if !strings.Contains(mask, "!") || !strings.Contains(mask, "@") {
+				problems.Add(file, config.IndexPath(config.KeyPath(path, "masks"), i), "%q is not a nick!user@host mask", mask)
+			}
+		}
+		for channel, role := range user.Roles {
+			rolePath := config.MapKeyPath(config.KeyPath(path, "roles"), channel)
+			if channel != "*" && !config.ValidChannelName(channel) {
+				problems.Add(file, rolePath, "%q is not a channel name or *", channel)
+			}
+			checkRole(&problems, file, rolePath, role)
+		}
+	}
+	sortProblems(problems)
+	return problems.Err()
+}
+
+// sortProblems orders problems by their path, since they were found walking maps
+func sortProblems(problems config.Problems) {
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+}
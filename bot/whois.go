@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+)
+
+// WhoisResult is what a WHOIS said about a nick
+type WhoisResult struct {
+	Hostmask string   // user@host, empty when the nick is not online
+	Channels []string // channels with prefixes from RPL_WHOISCHANNELS
+}
+
+// pendingWhois is a WHOIS of one nick in progress
+type pendingWhois struct {
+	callbacks []func(WhoisResult)
+	result    WhoisResult
+}
+
+// whoisTracker collects the WHOIS replies of a connection for the lookups waiting for them
+type whoisTracker struct {
+	mu      sync.Mutex
+	pending map[string]*pendingWhois // lowercase nick -> lookup
+}
+
+func newWhoisTracker() *whoisTracker {
+	return &whoisTracker{pending: make(map[string]*pendingWhois)}
+}
+
+// Whois looks up a nick and calls callback with the result once the WHOIS ends, so the account from
+// RPL_WHOISACCOUNT is known by then. Lookups of a nick that is already being looked up are queued
+// and all get the result of the next WHOIS that ends. Callbacks run without any lock held.
+func (c *Connection) Whois(nick string, callback func(WhoisResult)) {
+	c.whois.add(nick, callback)
+	c.SendRaw("WHOIS " + nick)
+}
+
+// add queues a callback for the WHOIS of a nick
+func (t *whoisTracker) add(nick string, callback func(WhoisResult)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := strings.ToLower(nick)
+	lookup, exists := t.pending[key]
+	if !exists {
+		lookup = &pendingWhois{}
+		t.pending[key] = lookup
+	}
+	lookup.callbacks = append(lookup.callbacks, callback)
+}
+
+// user records the user@host from RPL_WHOISUSER
+func (t *whoisTracker) user(nick, hostmask string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if lookup, exists := t.pending[strings.ToLower(nick)]; exists {
+		lookup.result.Hostmask = hostmask
+	}
+}
+
+// channels records the channels from RPL_WHOISCHANNELS, which may come in several lines
+func (t *whoisTracker) channels(nick string, channels []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if lookup, exists := t.pending[strings.ToLower(nick)]; exists {
+		lookup.result.Channels = append(lookup.result.Channels, channels...)
+	}
+}
+
+// end finishes the WHOIS of a nick on RPL_ENDOFWHOIS and runs its callbacks
+func (t *whoisTracker) end(nick string) {
+	t.mu.Lock()
+	key := strings.ToLower(nick)
+	lookup, exists := t.pending[key]
+	delete(t.pending, key)
+	t.mu.Unlock()
+
+	if exists {
+		for _, callback := range lookup.callbacks {
+			callback(lookup.result)
+		}
+	}
+}
+
+// reset drops the lookups in progress, whose replies will not come after a disconnect
+func (t *whoisTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.pending)
+}
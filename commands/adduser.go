@@ -5,17 +5,20 @@ import (
 	"mbot/bot"
 	"strings"
 
-	"github.com/ergochat/irc-go/ircevent"
 	"github.com/fatih/color"
 )
 
 // Handler for the AddUser command
-func AddUserCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func AddUserCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	nickname := bot.ExtractNickname(sender)
 
 	parts := strings.Fields(message)
+	if len(parts) >= 2 && strings.ToLower(parts[1]) == "mask" {
+		AddMaskCommand(connection, sender, target, parts, users)
+		return
+	}
 	if len(parts) < 3 {
-		connection.Privmsg(target, "Usage: !adduser <nickname> <role> [<channel>]")
+		connection.Privmsg(target, "Usage: !adduser <nickname|$a:account|nick!user@host> <role> [<channel>] or !adduser mask <user> <nick!user@host>")
 		color.Red(">> Invalid command format: %s", message)
 		return
 	}
@@ -26,74 +29,176 @@ func AddUserCommand(connection *ircevent.Connection, sender, target, message str
 		channel = parts[3]
 	}
 
-	// Map for valid roles to make it case-insensitive for better user experience
-	validRoles := map[string]string{
-		"owner":   "Owner",
-		"admin":   "Admin",
-		"trusted": "Trusted",
-		"regular": "Regular",
-		"badboy":  "BadBoy",
-	}
-
-	role, exists := validRoles[strings.ToLower(inputRole)]
+	// Roles are matched case-insensitively for better user experience, and stored as spelled in bot.UserRoles
+	role, exists := bot.FindRole(inputRole)
 	if !exists {
-		connection.Privmsg(target, "Invalid role. Valid roles are: Owner, Admin, Trusted, Regular, BadBoy")
+		connection.Privmsg(target, "Invalid role. Valid roles are: "+strings.Join(bot.RoleNames(), ", "))
 		color.Red(">> Invalid role: %s", inputRole)
 		return
 	}
 
-	bot.WhoisMu.Lock()
-	bot.PendingWhois[nick] = func(hostmask string) {
-		bot.WhoisMu.Unlock()
-		defer bot.WhoisMu.Lock()
-		if role == "Owner" {
-			for _, user := range users {
-				if user.Roles["*"] == "Owner" {
-					connection.Privmsg(target, "There is already an Owner. Only one Owner is allowed.")
-					color.Red(">> Attempted to add another Owner: %s", nick)
-					return
-				}
-			}
+	// Users can be registered directly by their NickServ account
+	if account, isAccount := strings.CutPrefix(nick, bot.AccountKeyPrefix); isAccount {
+		if account == "" {
+			connection.Privmsg(target, "Usage: !adduser <nickname|$a:account|nick!user@host> <role> [<channel>]")
+			return
 		}
+		addUserWithRole(connection, target, nickname, nick, account, "", "", role, channel, users)
+		return
+	}
 
-		if existingUser, exists := users[hostmask]; exists {
-			if existingUser.Roles["*"] == "Owner" {
-				connection.Privmsg(target, fmt.Sprintf("User %s is the Owner and cannot be demoted.", nick))
-				color.Red(">> Attempted to demote Owner: %s", nick)
-				return
-			}
+	// Or by a wildcard mask such as *!*@our.company.cloak/*
+	if strings.Contains(nick, "@") {
+		mask, err := bot.NormalizeMask(nick)
+		if err != nil {
+			connection.Privmsg(target, "Invalid mask: "+err.Error())
+			return
+		}
+		if bot.MatchesEveryone(mask) {
+			connection.Privmsg(target, fmt.Sprintf("Mask %s matches everyone, use a narrower one.", mask))
+			return
+		}
+		addUserWithRole(connection, target, nickname, mask, "", "", mask, role, channel, users)
+		return
+	}
 
-			if existingUserRole, exists := existingUser.Roles[channel]; exists && existingUserRole == role {
-				connection.Privmsg(target, fmt.Sprintf("User %s already has the role %s in %s.", nick, role, channel))
-				color.Yellow(">> User %s already has role %s in %s", nick, role, channel)
-				return
-			}
+	connection.Whois(nick, func(result bot.WhoisResult) {
+		hostmask := result.Hostmask
+		if hostmask == "" {
+			connection.Privmsg(target, fmt.Sprintf("Could not resolve hostmask for user %s.", nick))
+			color.Red(">> Could not resolve hostmask for user: %s", nick)
+			return
+		}
 
-			users[hostmask].Roles[channel] = role
-			if err := bot.SaveUsers(users); err != nil {
-				connection.Privmsg(target, "Error updating user: "+err.Error())
-				color.Red(">> Error updating user: %s", err.Error())
+		account := connection.Accounts.Get(nick)
+		addUserWithRole(connection, target, nickname, nick, account, hostmask, "", role, channel, users)
+	})
+}
+
+// Function to give a user a role, identified by mask, by account when known and by hostmask otherwise
+func addUserWithRole(connection *bot.Connection, target, nickname, nick, account, hostmask, mask, role, channel string, users map[string]bot.User) {
+	usersPath := connection.Network.UsersPath()
+
+	if role == "Owner" {
+		for _, user := range users {
+			if user.Roles["*"] == "Owner" {
+				connection.Privmsg(target, "There is already an Owner. Only one Owner is allowed.")
+				color.Red(">> Attempted to add another Owner: %s", nick)
 				return
 			}
+		}
+	}
+
+	var existingUser bot.User
+	var exists bool
+	if mask != "" {
+		existingUser, exists = bot.LookupUser(users, mask)
+	} else {
+		existingUser, exists = bot.FindUser(users, account, hostmask)
+	}
+
+	if exists {
+		if existingUser.Roles["*"] == "Owner" {
+			connection.Privmsg(target, fmt.Sprintf("User %s is the Owner and cannot be demoted.", nick))
+			color.Red(">> Attempted to demote Owner: %s", nick)
+			return
+		}
 
-			color.Green(">> User %s updated to role %s in %s", nick, role, channel)
-			connection.Privmsg(target, fmt.Sprintf("User %s's role has been updated to %s in %s.", nick, role, channel))
+		if existingUserRole, exists := existingUser.Roles[channel]; exists && existingUserRole == role {
+			connection.Privmsg(target, fmt.Sprintf("User %s already has the role %s in %s.", nick, role, channel))
+			color.Yellow(">> User %s already has role %s in %s", nick, role, channel)
 			return
 		}
 
-		user := bot.User{Hostmask: hostmask, Roles: map[string]string{channel: role}}
-		if err := bot.AddUser(users, user); err != nil {
-			connection.Privmsg(target, "Error adding user: "+err.Error())
-			color.Red(">> Error adding user: %s", err.Error())
+		// Move users found by hostmask over to their account once it is known
+		if existingUser.Account == "" && account != "" {
+			delete(users, existingUser.Key())
+			existingUser.Account = account
+		}
+
+		existingUser.Roles[channel] = role
+		if err := bot.UpdateUser(users, existingUser, usersPath); err != nil {
+			connection.Privmsg(target, "Error updating user: "+err.Error())
+			color.Red(">> Error updating user: %s", err.Error())
 			return
 		}
 
-		color.Green(">> User %s added with role %s in %s", nick, role, channel)
-		connection.Privmsg(target, fmt.Sprintf("User %s has added %s with role %s in %s.", nickname, nick, role, channel))
+		color.Green(">> User %s updated to role %s in %s", nick, role, channel)
+		connection.Privmsg(target, fmt.Sprintf("User %s's role has been updated to %s in %s.", nick, role, channel))
+		return
+	}
+
+	user := bot.User{Hostmask: hostmask, Account: account, Roles: map[string]string{channel: role}}
+	if mask != "" {
+		user.Masks = []string{mask}
+	}
+	if err := bot.AddUser(users, user, usersPath); err != nil {
+		connection.Privmsg(target, "Error adding user: "+err.Error())
+		color.Red(">> Error adding user: %s", err.Error())
+		return
+	}
+
+	color.Green(">> User %s added with role %s in %s", nick, role, channel)
+	connection.Privmsg(target, fmt.Sprintf("User %s has added %s with role %s in %s.", nickname, nick, role, channel))
+}
+
+// Handler for !adduser mask <user> <nick!user@host>, adding another mask to an existing user
+func AddMaskCommand(connection *bot.Connection, sender, target string, parts []string, users map[string]bot.User) {
+	if len(parts) < 4 {
+		connection.Privmsg(target, "Usage: !adduser mask <user> <nick!user@host>")
+		return
+	}
+
+	existingUser, exists := bot.LookupUser(users, parts[2])
+	if !exists {
+		connection.Privmsg(target, fmt.Sprintf("User %s does not exist.", parts[2]))
+		return
+	}
+
+	if !canChangeMasks(connection, sender, target, existingUser, users) {
+		return
+	}
+
+	mask, err := bot.NormalizeMask(parts[3])
+	if err != nil {
+		connection.Privmsg(target, "Invalid mask: "+err.Error())
+		return
+	}
+	if bot.MatchesEveryone(mask) {
+		connection.Privmsg(target, fmt.Sprintf("Mask %s matches everyone, use a narrower one.", mask))
+		return
+	}
+
+	key := existingUser.Key()
+	if !existingUser.AddMask(mask) {
+		connection.Privmsg(target, fmt.Sprintf("User %s already has the mask %s.", key, mask))
+		return
+	}
+
+	users[key] = existingUser
+	if err := bot.SaveUsers(users, connection.Network.UsersPath()); err != nil {
+		connection.Privmsg(target, "Error updating user: "+err.Error())
+		color.Red(">> Error updating user: %s", err.Error())
+		return
 	}
-	bot.WhoisMu.Unlock()
 
-	connection.SendRaw(fmt.Sprintf("WHOIS %s", nick))
+	color.Green(">> Mask %s added to user %s", mask, key)
+	connection.Privmsg(target, fmt.Sprintf("Mask %s added to user %s.", mask, key))
+}
+
+// Function to check that the sender may change the masks of a user. Only the Owner may change the
+// Owner's masks, since a mask added there makes everyone matching it Owner.
+func canChangeMasks(connection *bot.Connection, sender, target string, user bot.User, users map[string]bot.User) bool {
+	if user.Roles["*"] != "Owner" {
+		return true
+	}
+	account := connection.Accounts.Get(bot.ExtractNickname(sender))
+	if bot.GetUserRoleLevelByAccount(users, account, sender, target) >= bot.RoleOwner {
+		return true
+	}
+	connection.Privmsg(target, fmt.Sprintf("User %s is the Owner, only the Owner can change their masks.", user.Key()))
+	color.Red(">> Attempted to change the masks of the Owner: %s", sender)
+	return false
 }
 
 // RegisterAddUserCommand registers the !adduser command
@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"mbot/bot"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const announceUsage = "Usage: !announce add <minute hour day month weekday|@daily|@hourly|@weekly|@monthly> <#channel> [--topic] <text>, !announce list [#channel], !announce next <id>, !announce pause <id>, !announce resume <id> or !announce remove <id>"
+
+// Layout used to show when an announcement runs
+const announceTimeLayout = "Mon 2 Jan 15:04 MST"
+
+// Handler for the !announce command
+func AnnounceCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)[1:]
+	if len(parts) == 0 {
+		connection.Privmsg(target, announceUsage)
+		return
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "add":
+		addAnnouncement(connection, sender, target, parts[1:], users)
+
+	case "list":
+		channel := ""
+		if len(parts) > 1 {
+			channel = parts[1]
+		}
+		listAnnouncements(connection, target, channel)
+
+	case "next", "preview":
+		a, found := announcementByID(connection, target, parts)
+		if !found {
+			return
+		}
+		var runs []string
+		for _, run := range a.NextRuns(time.Now(), 5) {
+			runs = append(runs, run.Format(announceTimeLayout))
+		}
+		if len(runs) == 0 {
+			connection.Privmsg(target, fmt.Sprintf("Announcement #%d never runs.", a.ID))
+			return
+		}
+		preview := bot.FormatAnnouncement(connection, a, time.Now())
+		connection.SendLong(target, fmt.Sprintf("Announcement #%d next runs: %s. Preview: %s", a.ID, strings.Join(runs, ", "), preview))
+
+	case "pause", "resume":
+		a, found := announcementByID(connection, target, parts)
+		if !found {
+			return
+		}
+		if !canManageChannel(connection, sender, target, a.Channel, users) {
+			connection.Privmsg(target, fmt.Sprintf("You need to be an Admin in %s to change announcement #%d.", a.Channel, a.ID))
+			return
+		}
+		paused := strings.EqualFold(parts[0], "pause")
+		if _, err := connection.Network.Announcements.SetPaused(connection.Network.Name, a.ID, paused); err != nil {
+			color.Red(">> Error saving announcements: %v", err)
+			connection.Privmsg(target, "Failed to save announcements: "+err.Error())
+			return
+		}
+		if paused {
+			connection.Privmsg(target, fmt.Sprintf("Announcement #%d paused.", a.ID))
+			return
+		}
+		a, _ = connection.Network.Announcements.Get(connection.Network.Name, a.ID)
+		connection.Privmsg(target, fmt.Sprintf("Announcement #%d resumed, next run %s.", a.ID, a.NextRun.Format(announceTimeLayout)))
+
+	case "remove", "del", "delete":
+		a, found := announcementByID(connection, target, parts)
+		if !found {
+			return
+		}
+		if !canManageChannel(connection, sender, target, a.Channel, users) {
+			connection.Privmsg(target, fmt.Sprintf("You need to be an Admin in %s to change announcement #%d.", a.Channel, a.ID))
+			return
+		}
+		if _, err := connection.Network.Announcements.Remove(connection.Network.Name, a.ID); err != nil {
+			color.Red(">> Error saving announcements: %v", err)
+			connection.Privmsg(target, "Failed to save announcements: "+err.Error())
+			return
+		}
+		connection.Privmsg(target, fmt.Sprintf("Announcement #%d removed.", a.ID))
+
+	default:
+		connection.Privmsg(target, announceUsage)
+	}
+}
+
+// Function to add an announcement from the words after !announce add
+func addAnnouncement(connection *bot.Connection, sender, target string, args []string, users map[string]bot.User) {
+	// The schedule is either one @macro or five cron fields
+	fieldCount := 5
+	if len(args) > 0 && strings.HasPrefix(args[0], "@") {
+		fieldCount = 1
+	}
+	if len(args) < fieldCount+2 {
+		connection.Privmsg(target, announceUsage)
+		return
+	}
+	cron := strings.Join(args[:fieldCount], " ")
+	channel := args[fieldCount]
+	rest := args[fieldCount+1:]
+
+	if !connection.Channels.IsChannel(channel) {
+		connection.Privmsg(target, fmt.Sprintf("%s is not a channel. %s", channel, announceUsage))
+		return
+	}
+	if !canManageChannel(connection, sender, target, channel, users) {
+		connection.Privmsg(target, fmt.Sprintf("You need to be an Admin in %s to schedule announcements there.", channel))
+		return
+	}
+	nick := bot.ExtractNickname(sender)
+	account := connection.Accounts.Get(nick)
+
+	setTopic := false
+	if rest[0] == "--topic" {
+		setTopic = true
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		connection.Privmsg(target, "What should I announce? "+announceUsage)
+		return
+	}
+
+	a, err := connection.Network.Announcements.Add(bot.Announcement{
+		Network:   connection.Network.Name,
+		Channel:   channel,
+		Cron:      cron,
+		Timezone:  connection.Network.Reminders.Timezone(nick, account).String(),
+		Text:      strings.Join(rest, " "),
+		SetTopic:  setTopic,
+		CreatedBy: nick,
+	})
+	if err != nil {
+		color.Red(">> Error adding announcement: %v", err)
+		connection.Privmsg(target, "Failed to add the announcement: "+err.Error())
+		return
+	}
+
+	what := "Announcement"
+	if setTopic {
+		what = "Topic change"
+	}
+	connection.Privmsg(target, fmt.Sprintf("%s #%d for %s scheduled (%s, %s), next run %s.",
+		what, a.ID, a.Channel, a.Cron, a.Timezone, a.NextRun.Format(announceTimeLayout)))
+}
+
+// Function to list the announcements of the network or one channel
+func listAnnouncements(connection *bot.Connection, target, channel string) {
+	announcements := connection.Network.Announcements.List(connection.Network.Name, channel)
+	if len(announcements) == 0 {
+		connection.Privmsg(target, "No announcements are scheduled.")
+		return
+	}
+	var lines []string
+	for _, a := range announcements {
+		state := "next " + a.NextRun.Format(announceTimeLayout)
+		if a.Paused {
+			state = "paused"
+		} else if a.NextRun.IsZero() {
+			state = "never runs"
+		}
+		kind := ""
+		if a.SetTopic {
+			kind = " topic"
+		}
+		lines = append(lines, fmt.Sprintf("#%d %s%s [%s] %s: %s", a.ID, a.Channel, kind, a.Cron, state, a.Text))
+	}
+	connection.SendLong(target, "Announcements: "+strings.Join(lines, " | "))
+}
+
+// Function to look up the announcement named by the id in parts[1], replying when it can't be found
+func announcementByID(connection *bot.Connection, target string, parts []string) (bot.Announcement, bool) {
+	id, err := 0, errors.New("missing id")
+	if len(parts) == 2 {
+		id, err = strconv.Atoi(strings.TrimPrefix(parts[1], "#"))
+	}
+	if err != nil {
+		connection.Privmsg(target, fmt.Sprintf("Usage: !announce %s <id>", strings.ToLower(parts[0])))
+		return bot.Announcement{}, false
+	}
+	a, found := connection.Network.Announcements.Get(connection.Network.Name, id)
+	if !found {
+		connection.Privmsg(target, fmt.Sprintf("There is no announcement #%d.", id))
+	}
+	return a, found
+}
+
+// RegisterAnnounceCommand registers the !announce command
+func RegisterAnnounceCommand() {
+	bot.RegisterCommand("!announce", AnnounceCommand)
+}
@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"fmt"
+	"mbot/bot"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Handler for the !ban command
+func BanCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)
+	if len(parts) < 2 || !connection.Channels.IsChannel(target) {
+		connection.Privmsg(target, "Usage: !ban <nickname> [duration] [reason] (in a channel, durations like 30m, 2h or 1d)")
+		return
+	}
+	nick := parts[1]
+	channel := target
+
+	// The duration is optional, anything that does not parse as one starts the reason
+	var duration time.Duration
+	reasonParts := parts[2:]
+	if len(reasonParts) > 0 {
+		if d, err := bot.ParseDuration(reasonParts[0]); err == nil {
+			duration = d
+			reasonParts = reasonParts[1:]
+		}
+	}
+	reason := strings.Join(reasonParts, " ")
+
+	connection.Whois(nick, func(result bot.WhoisResult) {
+		hostmask := result.Hostmask
+		if hostmask == "" {
+			connection.Privmsg(target, fmt.Sprintf("Could not resolve hostmask for user %s.", nick))
+			color.Red(">> Could not resolve hostmask for user: %s", nick)
+			return
+		}
+		banUser(connection, channel, sender, nick, hostmask, duration, reason)
+	})
+}
+
+// Function to ban a resolved user, kick them if configured and remember the ban when it is timed
+func banUser(connection *bot.Connection, channel, sender, nick, hostmask string, duration time.Duration, reason string) {
+	settings := connection.Config.Bans
+	user, host, _ := strings.Cut(hostmask, "@")
+	mask := bot.BuildBanMask(settings.MaskStyle, nick, user, host)
+
+	connection.Send("MODE", channel, "+b", mask)
+	if settings.Kick {
+		kickReason := reason
+		if kickReason == "" {
+			kickReason = "Banned"
+		}
+		connection.Send("KICK", channel, nick, kickReason)
+	}
+
+	if duration == 0 {
+		color.Yellow(">> %s banned %s (%s) in %s", sender, nick, mask, channel)
+		connection.Privmsg(channel, fmt.Sprintf("Banned %s (%s).", nick, mask))
+		return
+	}
+
+	now := time.Now()
+	ban := bot.TimedBan{
+		Network:   connection.Network.Name,
+		Channel:   channel,
+		Mask:      mask,
+		Nick:      nick,
+		SetBy:     bot.ExtractNickname(sender),
+		Reason:    reason,
+		SetAt:     now,
+		ExpiresAt: now.Add(duration),
+	}
+	if err := connection.Network.Bans.Add(ban); err != nil {
+		color.Red(">> Error saving bans: %v", err)
+		connection.Privmsg(channel, fmt.Sprintf("Banned %s (%s), but the ban could not be saved and will not be lifted automatically.", nick, mask))
+		return
+	}
+
+	color.Yellow(">> %s banned %s (%s) in %s for %s", sender, nick, mask, channel, bot.FormatDuration(duration))
+	connection.Privmsg(channel, fmt.Sprintf("Banned %s (%s) for %s.", nick, mask, bot.FormatDuration(duration)))
+}
+
+// Handler for the !unban command
+func UnbanCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)
+	if len(parts) < 2 || !connection.Channels.IsChannel(target) {
+		connection.Privmsg(target, "Usage: !unban <nickname|mask> (in a channel)")
+		return
+	}
+	channel := target
+	mask := parts[1]
+
+	// A nick banned with a timed ban is unbanned by the mask the bot set
+	if ban, found := connection.Network.Bans.Find(connection.Network.Name, channel, mask); found {
+		mask = ban.Mask
+		if _, err := connection.Network.Bans.Remove(ban); err != nil {
+			color.Red(">> Error saving bans: %v", err)
+		}
+	}
+
+	connection.Send("MODE", channel, "-b", mask)
+}
+
+// Handler for the !bans command
+func BansCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)
+	channel := target
+	if len(parts) > 1 {
+		channel = parts[1]
+	}
+	if !connection.Channels.IsChannel(channel) {
+		connection.Privmsg(target, "Usage: !bans <channel>")
+		return
+	}
+
+	bans := connection.Network.Bans.List(connection.Network.Name, channel)
+	if len(bans) == 0 {
+		connection.Privmsg(target, fmt.Sprintf("No timed bans in %s.", channel))
+		return
+	}
+
+	var lines []string
+	for _, ban := range bans {
+		expires := "expired, lifted soon"
+		if remaining := time.Until(ban.ExpiresAt); remaining > 0 {
+			expires = "expires in " + bot.FormatDuration(remaining)
+		}
+		line := fmt.Sprintf("%s (%s) by %s, %s", ban.Mask, ban.Nick, ban.SetBy, expires)
+		if ban.ListMode() != "b" {
+			line = fmt.Sprintf("+%s %s", ban.ListMode(), line)
+		}
+		if ban.Reason != "" {
+			line += ": " + ban.Reason
+		}
+		lines = append(lines, line)
+	}
+	connection.SendLong(target, fmt.Sprintf("Timed bans in %s: %s", channel, strings.Join(lines, " | ")))
+}
+
+// RegisterBanCommands registers the ban commands
+func RegisterBanCommands() {
+	bot.RegisterCommand("!ban", BanCommand)
+	bot.RegisterCommand("!unban", UnbanCommand)
+	bot.RegisterCommand("!bans", BansCommand)
+}
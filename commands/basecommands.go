@@ -3,34 +3,52 @@ package commands
 import (
 	"mbot/bot"
 	"strings"
+	"time"
 
-	"github.com/ergochat/irc-go/ircevent"
+	"github.com/fatih/color"
 )
 
-// Handler for the !join command
-func JoinCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+// Handler for the !join command. The channel and its key are saved so the bot joins it again after a restart.
+func JoinCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 2 {
-		connection.Privmsg(target, "Usage: !join <channel>")
+		connection.Privmsg(target, "Usage: !join <channel> [key]")
 		return
 	}
 	channel := parts[1]
+	key := ""
+	if len(parts) > 2 {
+		key = parts[2]
+	}
+	err := connection.Network.Joined.Add(bot.JoinedChannel{
+		Network: connection.Network.Name,
+		Name:    channel,
+		Key:     key,
+		AddedBy: bot.ExtractNickname(sender),
+		AddedAt: time.Now(),
+	})
+	if err != nil {
+		color.Red(">> Error saving the channel list: %v", err)
+	}
 	connection.Join(channel)
 }
 
 // Handler for the !part command
-func PartCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func PartCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 2 {
 		connection.Privmsg(target, "Usage: !part <channel>")
 		return
 	}
 	channel := parts[1]
+	if _, err := connection.Network.Joined.Remove(connection.Network.Name, channel); err != nil {
+		color.Red(">> Error saving the channel list: %v", err)
+	}
 	connection.Part(channel)
 }
 
 // Handler for the !topic command
-func TopicCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func TopicCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 3 {
 		connection.Privmsg(target, "Usage: !topic <channel> <new topic>")
@@ -42,7 +60,7 @@ func TopicCommand(connection *ircevent.Connection, sender, target, message strin
 }
 
 // Handler for the !nick command
-func NickCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func NickCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 2 {
 		connection.Privmsg(target, "Usage: !nick <new nickname>")
@@ -53,7 +71,7 @@ func NickCommand(connection *ircevent.Connection, sender, target, message string
 }
 
 // Handler for the !invite command
-func InviteCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func InviteCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 3 {
 		connection.Privmsg(target, "Usage: !invite <nickname> <channel>")
@@ -65,7 +83,7 @@ func InviteCommand(connection *ircevent.Connection, sender, target, message stri
 }
 
 // Handler for the !op command
-func OpCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func OpCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 2 {
 		connection.Privmsg(target, "Usage: !op <nickname>")
@@ -76,7 +94,7 @@ func OpCommand(connection *ircevent.Connection, sender, target, message string,
 }
 
 // Handler for the !deop command
-func DeopCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func DeopCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 2 {
 		connection.Privmsg(target, "Usage: !deop <nickname>")
@@ -87,7 +105,7 @@ func DeopCommand(connection *ircevent.Connection, sender, target, message string
 }
 
 // Handler for the !voice command
-func VoiceCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func VoiceCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 2 {
 		connection.Privmsg(target, "Usage: !voice <nickname>")
@@ -98,7 +116,7 @@ func VoiceCommand(connection *ircevent.Connection, sender, target, message strin
 }
 
 // Handler for the !devoice command
-func DevoiceCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func DevoiceCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 2 {
 		connection.Privmsg(target, "Usage: !devoice <nickname>")
@@ -109,7 +127,7 @@ func DevoiceCommand(connection *ircevent.Connection, sender, target, message str
 }
 
 // Handler for the !kick command
-func KickCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func KickCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	parts := strings.Fields(message)
 	if len(parts) < 2 {
 		connection.Privmsg(target, "Usage: !kick <nickname> [reason]")
@@ -123,30 +141,8 @@ func KickCommand(connection *ircevent.Connection, sender, target, message string
 	connection.Send("KICK", target, nickname, reason)
 }
 
-// Handler for the !ban command
-func BanCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
-	parts := strings.Fields(message)
-	if len(parts) < 2 {
-		connection.Privmsg(target, "Usage: !ban <nickname>")
-		return
-	}
-	nickname := parts[1]
-	connection.Send("MODE", target, "+b", nickname)
-}
-
-// Handler for the !unban command
-func UnbanCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
-	parts := strings.Fields(message)
-	if len(parts) < 2 {
-		connection.Privmsg(target, "Usage: !unban <nickname>")
-		return
-	}
-	nickname := parts[1]
-	connection.Send("MODE", target, "-b", nickname)
-}
-
 // Handler for the !shutdown command
-func ShutdownCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func ShutdownCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	connection.Quit()
 	bot.ShutdownBot(connection)
 }
@@ -163,7 +159,5 @@ func RegisterBaseCommands() {
 	bot.RegisterCommand("!voice", VoiceCommand)
 	bot.RegisterCommand("!devoice", DevoiceCommand)
 	bot.RegisterCommand("!kick", KickCommand)
-	bot.RegisterCommand("!ban", BanCommand)
-	bot.RegisterCommand("!unban", UnbanCommand)
 	bot.RegisterCommand("!shutdown", ShutdownCommand)
 }
@@ -3,7 +3,6 @@ package commands
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,14 +11,17 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
-	"github.com/ergochat/irc-go/ircevent"
 	"github.com/fatih/color"
 	"github.com/liushuangls/go-anthropic/v2"
 )
 
+// Answers that need more IRC lines than this are pasted instead
+const maxClaudeAnswerLines = 3
+
 // ClaudeCommand handles the !claude command
-func ClaudeCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func ClaudeCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	fmt.Println(">> ClaudeCommand called with sender:", sender, "target:", target, "message:", message)
 	// Extract the question from the message
 	question := strings.TrimPrefix(message, "!claude ")
@@ -49,8 +51,8 @@ func ClaudeCommand(connection *ircevent.Connection, sender, target, message stri
 	// Send the response to the IRC channel
 	if len(resp.Content) > 0 {
 		answer := resp.Content[0].GetText()
-		if len(answer) < 450 {
-			connection.Privmsg(target, answer)
+		if len(connection.SplitMessage(target, answer)) <= maxClaudeAnswerLines {
+			connection.SendLong(target, answer)
 		} else {
 
 			pasteurl, err := PasteService(answer)
@@ -87,12 +89,8 @@ func PasteService(content string) (string, error) {
 		return "", fmt.Errorf("error marshaling request data: %v", err)
 	}
 
-	// Create an HTTP client with TLS configuration to skip verification
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+	// The default transport verifies certificates with the TLS settings from the config
+	client := &http.Client{Timeout: 30 * time.Second}
 
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
 	if err != nil {
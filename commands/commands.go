@@ -1,6 +1,10 @@
 package commands
 
-import "mbot/config"
+import (
+	"mbot/bot"
+	"mbot/config"
+	"strings"
+)
 
 // RegisterAllCommands registers all commands in the package
 func RegisterAllCommands() {
@@ -8,6 +12,14 @@ func RegisterAllCommands() {
 	RegisterHello2Command()       // Hello2 example command
 	RegisterURLCommand()          // URL command to enable/disable URL features (YouTube, Wikipedia, etc.)
 	RegisterBaseCommands()        // Base commands (op, deop, kick, etc.)
+	RegisterBanCommands()         // Ban commands (timed bans that are lifted automatically)
+	RegisterOnJoinCommand()       // OnJoin command (auto-op, auto-voice and greetings on join)
+	RegisterModLogCommand()       // ModLog command (actions taken by the flood and spam protection)
+	RegisterSeenCommand()         // Seen command (when a nick was last active)
+	RegisterTellCommand()         // Tell command (memos delivered when the recipient is back)
+	RegisterRemindCommand()       // Remind command (reminders at a set time)
+	RegisterAnnounceCommand()     // Announce command (scheduled channel announcements)
+	RegisterInvitesCommand()      // Invites command (invites waiting for the owner)
 	RegisterAddUserCommand()      // AddUser command (Used to add users to the bot)
 	RegisterRemoveUserCommand()   // RemoveUser command (Used to remove users from the bot)
 	RegisterPersonalityCommands() // Personality commands (Used to set the bot's personality for a channel)
@@ -16,6 +28,17 @@ func RegisterAllCommands() {
 	RegisterTriviaCommand()       // Trivia command
 	RegisterKBCommand()           // KB search command
 	RegisterClaudeCommand()       // Claude command (Anthropic API)
+	RegisterStatusCommand()       // Status command (Connection health and reconnects)
+}
+
+// Function to check that the sender may change the settings of a channel: anyone allowed to run the
+// command may in the channel the command runs in, elsewhere it takes an Admin of that channel
+func canManageChannel(connection *bot.Connection, sender, target, channel string, users map[string]bot.User) bool {
+	if strings.EqualFold(channel, target) {
+		return true
+	}
+	account := connection.Accounts.Get(bot.ExtractNickname(sender))
+	return bot.GetUserRoleLevelByAccount(users, account, sender, channel) >= bot.RoleAdmin
 }
 
 // GetDefaultPermissions returns the default command permissions for a given channel
@@ -32,6 +55,11 @@ func GetDefaultPermissions(channel string) map[string][]config.CommandPermission
 		"!trivia":     {{Role: "Everyone", Channels: []string{channel}}},
 		"!trivia-top": {{Role: "Everyone", Channels: []string{channel}}},
 
+		// Seen, tell and remind commands
+		"!seen":   {{Role: "Everyone", Channels: []string{channel}}},
+		"!tell":   {{Role: "Everyone", Channels: []string{channel}}},
+		"!remind": {{Role: "Everyone", Channels: []string{channel}}},
+
 		// kb search command
 		"!kb": {{Role: "Everyone", Channels: []string{channel}}},
 
@@ -44,17 +72,22 @@ func GetDefaultPermissions(channel string) map[string][]config.CommandPermission
 		"!yt":  {{Role: "Everyone", Channels: []string{channel}}},
 
 		// Base commands
-		"!op":      {{Role: "Admin", Channels: []string{channel}}},
-		"!deop":    {{Role: "Admin", Channels: []string{channel}}},
-		"!voice":   {{Role: "Admin", Channels: []string{channel}}},
-		"!devoice": {{Role: "Admin", Channels: []string{channel}}},
-		"!kick":    {{Role: "Admin", Channels: []string{channel}}},
-		"!ban":     {{Role: "Admin", Channels: []string{channel}}},
-		"!unban":   {{Role: "Admin", Channels: []string{channel}}},
-		"!invite":  {{Role: "Admin", Channels: []string{channel}}},
-		"!topic":   {{Role: "Admin", Channels: []string{channel}}},
-		"!join":    {{Role: "Admin", Channels: []string{channel}}},
-		"!part":    {{Role: "Admin", Channels: []string{channel}}},
+		"!op":       {{Role: "Admin", Channels: []string{channel}}},
+		"!deop":     {{Role: "Admin", Channels: []string{channel}}},
+		"!voice":    {{Role: "Admin", Channels: []string{channel}}},
+		"!devoice":  {{Role: "Admin", Channels: []string{channel}}},
+		"!kick":     {{Role: "Admin", Channels: []string{channel}}},
+		"!ban":      {{Role: "Admin", Channels: []string{channel}}},
+		"!unban":    {{Role: "Admin", Channels: []string{channel}}},
+		"!bans":     {{Role: "Admin", Channels: []string{channel}}},
+		"!onjoin":   {{Role: "Admin", Channels: []string{channel}}},
+		"!modlog":   {{Role: "Admin", Channels: []string{channel}}},
+		"!announce": {{Role: "Admin", Channels: []string{channel}}},
+		"!invite":   {{Role: "Admin", Channels: []string{channel}}},
+		"!topic":    {{Role: "Admin", Channels: []string{channel}}},
+		"!join":     {{Role: "Admin", Channels: []string{channel}}},
+		"!part":     {{Role: "Admin", Channels: []string{channel}}},
+		"!status":   {{Role: "Admin", Channels: []string{channel}}},
 
 		// Example command
 		"!hello": {{Role: "Everyone", Channels: []string{channel}}},
@@ -63,6 +96,7 @@ func GetDefaultPermissions(channel string) map[string][]config.CommandPermission
 		"!shutdown":  {{Role: "Owner", Channels: []string{channel}}},
 		"!nick":      {{Role: "Owner", Channels: []string{channel}}},
 		"!managecmd": {{Role: "Owner", Channels: []string{channel}}},
+		"!invites":   {{Role: "Owner", Channels: []string{channel}}},
 
 		// Trusted commands
 		"!hello2": {{Role: "Trusted", Channels: []string{channel}}}, // Example command for testing purposes
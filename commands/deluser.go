@@ -5,17 +5,20 @@ import (
 	"mbot/bot"
 	"strings"
 
-	"github.com/ergochat/irc-go/ircevent"
 	"github.com/fatih/color"
 )
 
 // Handler for the RemoveUser command
-func RemoveUserCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func RemoveUserCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	nickname := bot.ExtractNickname(sender)
 
 	parts := strings.Fields(message)
+	if len(parts) >= 2 && strings.ToLower(parts[1]) == "mask" {
+		RemoveMaskCommand(connection, sender, target, parts, users)
+		return
+	}
 	if len(parts) < 2 {
-		connection.Privmsg(target, "Usage: !deluser <nickname> [<channel>]")
+		connection.Privmsg(target, "Usage: !deluser <nickname|$a:account|nick!user@host> [<channel>] or !deluser mask <user> <nick!user@host>")
 		color.Red(">> Invalid command format: %s", message)
 		return
 	}
@@ -25,48 +28,100 @@ func RemoveUserCommand(connection *ircevent.Connection, sender, target, message
 		channel = parts[2]
 	}
 
-	bot.WhoisMu.Lock()
-	bot.PendingWhois[nick] = func(hostmask string) {
-		bot.WhoisMu.Unlock()
-		defer bot.WhoisMu.Lock()
+	// Users registered by account or mask can be removed without being online
+	if strings.HasPrefix(nick, bot.AccountKeyPrefix) || strings.Contains(nick, "@") {
+		existingUser, exists := bot.LookupUser(users, nick)
+		removeUserRole(connection, target, nickname, nick, existingUser, exists, channel, users)
+		return
+	}
 
+	connection.Whois(nick, func(result bot.WhoisResult) {
+		hostmask := result.Hostmask
 		if hostmask == "" {
 			connection.Privmsg(target, fmt.Sprintf("Could not resolve hostmask for user %s.", nick))
 			color.Red(">> Could not resolve hostmask for user: %s", nick)
 			return
 		}
 
-		if existingUser, exists := users[hostmask]; exists {
-			if existingUser.Roles["*"] == "Owner" {
-				connection.Privmsg(target, fmt.Sprintf("User %s is the Owner and cannot be removed.", nick))
-				color.Red(">> Attempted to remove Owner: %s", nick)
-				return
-			}
+		account := connection.Accounts.Get(nick)
+		existingUser, exists := bot.FindUser(users, account, hostmask)
+		removeUserRole(connection, target, nickname, nick, existingUser, exists, channel, users)
+	})
+}
 
-			if _, exists := existingUser.Roles[channel]; exists {
-				delete(users[hostmask].Roles, channel)
-				if err := bot.SaveUsers(users); err != nil {
-					connection.Privmsg(target, "Error removing user: "+err.Error())
-					color.Red(">> Error removing user: %s", err.Error())
-					return
-				}
+// Function to remove a user's role in a channel
+func removeUserRole(connection *bot.Connection, target, nickname, nick string, existingUser bot.User, exists bool, channel string, users map[string]bot.User) {
+	if exists {
+		if existingUser.Roles["*"] == "Owner" {
+			connection.Privmsg(target, fmt.Sprintf("User %s is the Owner and cannot be removed.", nick))
+			color.Red(">> Attempted to remove Owner: %s", nick)
+			return
+		}
 
-				color.Green(">> User %s removed from %s", nick, channel)
-				connection.Privmsg(target, fmt.Sprintf("User %s has been removed by %s from %s.", nick, nickname, channel))
+		if _, exists := existingUser.Roles[channel]; exists {
+			delete(existingUser.Roles, channel)
+			if err := bot.SaveUsers(users, connection.Network.UsersPath()); err != nil {
+				connection.Privmsg(target, "Error removing user: "+err.Error())
+				color.Red(">> Error removing user: %s", err.Error())
 				return
 			}
 
-			connection.Privmsg(target, fmt.Sprintf("User %s does not have any role in %s.", nick, channel))
-			color.Yellow(">> User %s does not have any role in %s", nick, channel)
+			color.Green(">> User %s removed from %s", nick, channel)
+			connection.Privmsg(target, fmt.Sprintf("User %s has been removed by %s from %s.", nick, nickname, channel))
 			return
 		}
 
-		connection.Privmsg(target, fmt.Sprintf("User %s does not exist.", nick))
-		color.Yellow(">> User %s does not exist", nick)
+		connection.Privmsg(target, fmt.Sprintf("User %s does not have any role in %s.", nick, channel))
+		color.Yellow(">> User %s does not have any role in %s", nick, channel)
+		return
+	}
+
+	connection.Privmsg(target, fmt.Sprintf("User %s does not exist.", nick))
+	color.Yellow(">> User %s does not exist", nick)
+}
+
+// Handler for !deluser mask <user> <nick!user@host>, removing a mask from an existing user
+func RemoveMaskCommand(connection *bot.Connection, sender, target string, parts []string, users map[string]bot.User) {
+	if len(parts) < 4 {
+		connection.Privmsg(target, "Usage: !deluser mask <user> <nick!user@host>")
+		return
+	}
+
+	existingUser, exists := bot.LookupUser(users, parts[2])
+	if !exists {
+		connection.Privmsg(target, fmt.Sprintf("User %s does not exist.", parts[2]))
+		return
+	}
+	if !canChangeMasks(connection, sender, target, existingUser, users) {
+		return
+	}
+
+	mask, err := bot.NormalizeMask(parts[3])
+	if err != nil {
+		connection.Privmsg(target, "Invalid mask: "+err.Error())
+		return
+	}
+
+	oldKey := existingUser.Key()
+	if !existingUser.RemoveMask(mask) {
+		connection.Privmsg(target, fmt.Sprintf("User %s does not have the mask %s.", oldKey, mask))
+		return
+	}
+	if existingUser.Key() == "" {
+		connection.Privmsg(target, fmt.Sprintf("Mask %s is the last way to identify %s. Use !deluser to remove the user instead.", mask, oldKey))
+		return
+	}
+
+	// Users identified only by masks are stored under their first mask
+	delete(users, oldKey)
+	if err := bot.UpdateUser(users, existingUser, connection.Network.UsersPath()); err != nil {
+		connection.Privmsg(target, "Error updating user: "+err.Error())
+		color.Red(">> Error updating user: %s", err.Error())
+		return
 	}
-	bot.WhoisMu.Unlock()
 
-	connection.SendRaw(fmt.Sprintf("WHOIS %s", nick))
+	color.Green(">> Mask %s removed from user %s", mask, existingUser.Key())
+	connection.Privmsg(target, fmt.Sprintf("Mask %s removed from user %s.", mask, existingUser.Key()))
 }
 
 // RegisterRemoveUserCommand registers the !deluser command
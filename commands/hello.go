@@ -2,12 +2,10 @@ package commands
 
 import (
 	"mbot/bot"
-
-	"github.com/ergochat/irc-go/ircevent"
 )
 
 // Handler for the !hello command
-func HelloCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func HelloCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	nickname := bot.ExtractNickname(sender)
 	connection.Privmsg(target, "Hello, "+nickname+"!")
 
@@ -2,12 +2,10 @@ package commands
 
 import (
 	"mbot/bot"
-
-	"github.com/ergochat/irc-go/ircevent"
 )
 
 // Handler for the !hello command
-func HelloCommand2(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func HelloCommand2(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	nickname := bot.ExtractNickname(sender)
 	connection.Privmsg(target, "Hello, "+nickname+"!")
 
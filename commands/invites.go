@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"mbot/bot"
+	"strings"
+	"time"
+)
+
+const invitesUsage = "Usage: !invites [list], !invites accept <channel> or !invites reject <channel>"
+
+// Handler for the !invites command. Owners can also use it by private message.
+func InvitesCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)[1:]
+	nick := bot.ExtractNickname(sender)
+
+	if len(parts) == 0 || strings.EqualFold(parts[0], "list") {
+		pending := connection.PendingInvites()
+		if len(pending) == 0 {
+			connection.Privmsg(target, "No invites are waiting.")
+			return
+		}
+		var lines []string
+		for _, invite := range pending {
+			lines = append(lines, fmt.Sprintf("%s from %s, %s ago", invite.Channel, invite.From, bot.FormatRoughDuration(time.Since(invite.At))))
+		}
+		connection.SendLong(target, "Pending invites: "+strings.Join(lines, " | "))
+		return
+	}
+
+	if len(parts) != 2 {
+		connection.Privmsg(target, invitesUsage)
+		return
+	}
+	channel := parts[1]
+	switch strings.ToLower(parts[0]) {
+	case "accept":
+		invite, found := connection.AcceptInvite(channel, nick)
+		if !found {
+			connection.Privmsg(target, fmt.Sprintf("There is no pending invite to %s.", channel))
+			return
+		}
+		connection.Privmsg(target, fmt.Sprintf("Joining %s, invited by %s.", invite.Channel, bot.ExtractNickname(invite.From)))
+
+	case "reject":
+		invite, found := connection.RejectInvite(channel)
+		if !found {
+			connection.Privmsg(target, fmt.Sprintf("There is no pending invite to %s.", channel))
+			return
+		}
+		connection.Privmsg(target, fmt.Sprintf("Invite to %s from %s rejected.", invite.Channel, bot.ExtractNickname(invite.From)))
+
+	default:
+		connection.Privmsg(target, invitesUsage)
+	}
+}
+
+// RegisterInvitesCommand registers the !invites command
+func RegisterInvitesCommand() {
+	bot.RegisterCommand("!invites", InvitesCommand)
+}
@@ -5,12 +5,10 @@ import (
 	"mbot/bot"
 	"os/exec"
 	"strings"
-
-	"github.com/ergochat/irc-go/ircevent"
 )
 
 // Handler for the !kb command
-func KBCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func KBCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	fmt.Println("Received command:", message) // Debug print
 
 	args := strings.Split(message, " ")
@@ -25,7 +23,7 @@ func KBCommand(connection *ircevent.Connection, sender, target, message string,
 
 	// Command execution
 	connection.Privmsg(target, "Scrapping KB update information from Microsoft...")
-	cmd := exec.Command("python3", "./kb/main.py", kbNumber)
+	cmd := exec.Command("python3", bot.AssetPath("kb/main.py"), kbNumber)
 	fmt.Println("Running Python script...") // Debug print
 	output, err := cmd.CombinedOutput()
 
@@ -56,17 +54,9 @@ func KBCommand(connection *ircevent.Connection, sender, target, message string,
 		return
 	}
 
-	// Split the description into chunks of 450 characters
-	chunkSize := 450
-	for i := 0; i < len(description); i += chunkSize {
-		end := i + chunkSize
-		if end > len(description) {
-			end = len(description)
-		}
-		chunk := description[i:end]
-		connection.Privmsg(target, chunk)
-		fmt.Println("Sending description chunk:", chunk) // Debug print
-	}
+	// Send the description, split over as many lines as needed
+	connection.SendLong(target, description)
+	fmt.Println("Sending description:", description) // Debug print
 
 	// Send the size
 	connection.Privmsg(target, "Size: "+size)
@@ -10,12 +10,10 @@ import (
 	"sort"
 	"strings"
 	"time"
-
-	"github.com/ergochat/irc-go/ircevent"
 )
 
 // Handler for the !managecmd command
-func ManageCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User, cmdCfg *config.CommandConfig, configPath string) {
+func ManageCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User, cmdCfg *config.CommandConfig, configPath string) {
 	args := strings.Fields(message)
 	if len(args) < 2 {
 		connection.Privmsg(target, "Usage: !managecmd <action> [parameters]")
@@ -141,7 +139,7 @@ func createBackup(configPath string) error {
 }
 
 // Edit an existing command's role and allowed channels
-func handleEditCommand(connection *ircevent.Connection, target string, args []string, cmdCfg *config.CommandConfig, configPath string) {
+func handleEditCommand(connection *bot.Connection, target string, args []string, cmdCfg *config.CommandConfig, configPath string) {
 	if len(args) < 5 {
 		connection.Privmsg(target, "Usage: !managecmd edit <command> <role> <channels...>")
 		return
@@ -197,7 +195,7 @@ func handleEditCommand(connection *ircevent.Connection, target string, args []st
 }
 
 // Add a new command to a specified role
-func handleAddCommand(connection *ircevent.Connection, target string, args []string, cmdCfg *config.CommandConfig, configPath string) {
+func handleAddCommand(connection *bot.Connection, target string, args []string, cmdCfg *config.CommandConfig, configPath string) {
 	if len(args) < 5 {
 		connection.Privmsg(target, "Usage: !managecmd add <command> <role> <channels...>")
 		return
@@ -240,7 +238,7 @@ func handleAddCommand(connection *ircevent.Connection, target string, args []str
 }
 
 // Remove a command from a specified role
-func handleRemoveCommand(connection *ircevent.Connection, target string, args []string, cmdCfg *config.CommandConfig, configPath string) {
+func handleRemoveCommand(connection *bot.Connection, target string, args []string, cmdCfg *config.CommandConfig, configPath string) {
 	if len(args) < 4 {
 		connection.Privmsg(target, "Usage: !managecmd remove <command> <role>")
 		return
@@ -276,7 +274,7 @@ func handleRemoveCommand(connection *ircevent.Connection, target string, args []
 }
 
 // List all permissions for a specified command
-func handleListCommands(connection *ircevent.Connection, target string, args []string, cmdCfg *config.CommandConfig) {
+func handleListCommands(connection *bot.Connection, target string, args []string, cmdCfg *config.CommandConfig) {
 	if len(args) < 3 {
 		connection.Privmsg(target, "Usage: !managecmd list <command>")
 		return
@@ -294,7 +292,7 @@ func handleListCommands(connection *ircevent.Connection, target string, args []s
 }
 
 // Setup default permissions for a new channel
-func handleSetupCommand(connection *ircevent.Connection, target string, args []string, cmdCfg *config.CommandConfig, configPath string) {
+func handleSetupCommand(connection *bot.Connection, target string, args []string, cmdCfg *config.CommandConfig, configPath string) {
 	if len(args) < 3 {
 		connection.Privmsg(target, "Usage: !managecmd setup <channel>")
 		return
@@ -349,13 +347,10 @@ func handleSetupCommand(connection *ircevent.Connection, target string, args []s
 	}
 
 	// Reload the command configuration
-	err = bot.ReloadCommandConfig(configPath)
+	err = connection.Network.ReloadCommandConfig()
 	if err != nil {
-		connection.Privmsg(target, fmt.Sprintf("Failed to reload command configuration: %v", err))
+		connection.Privmsg(target, fmt.Sprintf("Failed to reload command configuration: %s", config.Summary(err)))
 	}
-
-	// Re-register commands to reflect updated permissions
-	RegisterAllCommands()
 }
 
 // Save the command configuration to a file
@@ -376,8 +371,9 @@ func saveCommandConfig(cmdCfg *config.CommandConfig, configPath string) error {
 }
 
 // RegisterManageCommand registers the !managecmd command
-func RegisterManageCommand(cmdCfg *config.CommandConfig, configPath string) {
-	bot.RegisterCommand("!managecmd", func(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
-		ManageCommand(connection, sender, target, message, users, cmdCfg, configPath)
+func RegisterManageCommand() {
+	bot.RegisterCommand("!managecmd", func(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+		network := connection.Network
+		ManageCommand(connection, sender, target, message, users, network.CommandConfig(), network.CommandConfigPath())
 	})
 }
@@ -3,11 +3,9 @@ package commands
 import (
 	"mbot/bot"
 	"strings"
-
-	"github.com/ergochat/irc-go/ircevent"
 )
 
-func MemoryWipeCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func MemoryWipeCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	args := strings.SplitN(message, " ", 2)
 	if len(args) >= 2 && strings.TrimSpace(args[1]) == "wipe" {
 		bot.WipeUserMemory(sender)
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"fmt"
+	"mbot/bot"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultModLogEntries = 5
+	maxModLogEntries     = 20
+)
+
+// Handler for the !modlog command
+func ModLogCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)[1:]
+
+	channel := ""
+	if connection.Channels.IsChannel(target) {
+		channel = target
+	}
+	count := defaultModLogEntries
+	for _, part := range parts {
+		if connection.Channels.IsChannel(part) {
+			channel = part
+		} else if n, err := strconv.Atoi(part); err == nil && n > 0 {
+			count = min(n, maxModLogEntries)
+		} else {
+			connection.Privmsg(target, "Usage: !modlog [channel] [count]")
+			return
+		}
+	}
+
+	entries, err := bot.ReadModerationLog(connection.Network.ModerationLogPath(), channel, count)
+	if err != nil {
+		connection.Privmsg(target, "Failed to read the moderation log: "+err.Error())
+		return
+	}
+	if len(entries) == 0 {
+		connection.Privmsg(target, "No moderation actions logged.")
+		return
+	}
+
+	for _, entry := range entries {
+		connection.Privmsg(target, fmt.Sprintf("[%s] %s %s: %s (%s), strike %d, %s",
+			entry.Time.Format("2006-01-02 15:04"), entry.Channel, entry.Source, entry.Offense, entry.Detail, entry.Strike, entry.Action))
+	}
+}
+
+// RegisterModLogCommand registers the !modlog command
+func RegisterModLogCommand() {
+	bot.RegisterCommand("!modlog", ModLogCommand)
+}
@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"fmt"
+	"mbot/bot"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+const onJoinUsage = "Usage: !onjoin [channel] <show|op <role|off>|voice <role|off>|delay <seconds>|greeting <text|off>|usergreeting <user> <text|off>|welcome <notice|privmsg> <text>|welcome off|clear>"
+
+// Handler for the !onjoin command
+func OnJoinCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)[1:]
+
+	// The channel defaults to the one the command is used in
+	channel := target
+	if len(parts) > 0 && connection.Channels.IsChannel(parts[0]) {
+		channel = parts[0]
+		parts = parts[1:]
+	}
+	if !connection.Channels.IsChannel(channel) || len(parts) == 0 {
+		connection.Privmsg(target, onJoinUsage)
+		return
+	}
+	if !canManageChannel(connection, sender, target, channel, users) {
+		connection.Privmsg(target, fmt.Sprintf("You need to be an Admin in %s to change its join policy.", channel))
+		return
+	}
+
+	policies := connection.Network.JoinPolicies
+	setting := strings.ToLower(parts[0])
+	args := parts[1:]
+	text := strings.Join(args, " ")
+
+	var change func(policy *bot.JoinPolicy)
+	var reply string
+	switch {
+	case setting == "show":
+		showJoinPolicy(connection, target, channel)
+		return
+
+	case setting == "clear":
+		if err := policies.Remove(channel); err != nil {
+			connection.Privmsg(target, "Failed to save join policies: "+err.Error())
+			return
+		}
+		connection.Privmsg(target, fmt.Sprintf("Join policy for %s has been cleared.", channel))
+		return
+
+	case (setting == "op" || setting == "voice") && len(args) == 1:
+		role := args[0]
+		if strings.EqualFold(role, "off") {
+			role = ""
+		} else if _, valid := bot.UserRoles[role]; !valid || role == "BadBoy" {
+			connection.Privmsg(target, "Invalid role. Use Owner, Admin, Trusted or Everyone.")
+			return
+		}
+		change = func(policy *bot.JoinPolicy) {
+			if setting == "op" {
+				policy.OpRole = role
+			} else {
+				policy.VoiceRole = role
+			}
+		}
+		reply = fmt.Sprintf("Auto-%s in %s set to %s.", setting, channel, orOff(role))
+
+	case setting == "delay" && len(args) == 1:
+		seconds, err := strconv.Atoi(args[0])
+		if err != nil || seconds < 0 {
+			connection.Privmsg(target, "The delay must be a number of seconds.")
+			return
+		}
+		change = func(policy *bot.JoinPolicy) { policy.DelaySeconds = seconds }
+		reply = fmt.Sprintf("Auto-op and auto-voice in %s now wait %d seconds.", channel, seconds)
+
+	case setting == "greeting" && len(args) > 0:
+		if strings.EqualFold(text, "off") {
+			text = ""
+		}
+		change = func(policy *bot.JoinPolicy) { policy.Greeting = text }
+		reply = fmt.Sprintf("Greeting for %s set to: %s", channel, orOff(text))
+
+	case setting == "usergreeting" && len(args) > 1:
+		user, found := bot.LookupUser(users, args[0])
+		if !found {
+			connection.Privmsg(target, fmt.Sprintf("User %s not found. Use the key, $a:account, hostmask or mask from users.json.", args[0]))
+			return
+		}
+		greeting := strings.Join(args[1:], " ")
+		if strings.EqualFold(greeting, "off") {
+			greeting = ""
+		}
+		change = func(policy *bot.JoinPolicy) {
+			if greeting == "" {
+				delete(policy.UserGreetings, user.Key())
+				return
+			}
+			if policy.UserGreetings == nil {
+				policy.UserGreetings = make(map[string]string)
+			}
+			policy.UserGreetings[user.Key()] = greeting
+		}
+		reply = fmt.Sprintf("Greeting for %s in %s set to: %s", user.Key(), channel, orOff(greeting))
+
+	case setting == "welcome" && len(args) == 1 && strings.EqualFold(args[0], "off"):
+		change = func(policy *bot.JoinPolicy) { policy.Welcome, policy.WelcomeMethod = "", "" }
+		reply = fmt.Sprintf("Welcome text for %s turned off.", channel)
+
+	case setting == "welcome" && len(args) > 1:
+		method := strings.ToLower(args[0])
+		if method != bot.WelcomeNotice && method != bot.WelcomePrivmsg {
+			connection.Privmsg(target, "The welcome text is sent by notice or privmsg.")
+			return
+		}
+		welcome := strings.Join(args[1:], " ")
+		change = func(policy *bot.JoinPolicy) { policy.Welcome, policy.WelcomeMethod = welcome, method }
+		reply = fmt.Sprintf("First-time joiners of %s get this by %s: %s", channel, method, welcome)
+
+	default:
+		connection.Privmsg(target, onJoinUsage)
+		return
+	}
+
+	if err := policies.Update(channel, change); err != nil {
+		color.Red(">> Error saving join policies: %v", err)
+		connection.Privmsg(target, "Failed to save join policies: "+err.Error())
+		return
+	}
+	color.Green(">> %s changed the join policy of %s: %s", sender, channel, strings.Join(parts, " "))
+	connection.Privmsg(target, reply)
+}
+
+// Function to show the join policy of a channel
+func showJoinPolicy(connection *bot.Connection, target, channel string) {
+	policy, exists := connection.Network.JoinPolicies.Get(channel)
+	if !exists {
+		connection.Privmsg(target, fmt.Sprintf("No join policy for %s.", channel))
+		return
+	}
+
+	welcome := orOff(policy.Welcome)
+	if policy.Welcome != "" {
+		method := policy.WelcomeMethod
+		if method == "" {
+			method = bot.WelcomeNotice
+		}
+		welcome = fmt.Sprintf("%s by %s", policy.Welcome, method)
+	}
+	connection.SendLong(target, fmt.Sprintf("Join policy for %s: op %s, voice %s, delay %ds, greeting %s, %d user greetings, welcome %s",
+		channel, orOff(policy.OpRole), orOff(policy.VoiceRole), policy.DelaySeconds, orOff(policy.Greeting), len(policy.UserGreetings), welcome))
+}
+
+// Function to show an empty setting as off
+func orOff(value string) string {
+	if value == "" {
+		return "off"
+	}
+	return value
+}
+
+// RegisterOnJoinCommand registers the !onjoin command
+func RegisterOnJoinCommand() {
+	bot.RegisterCommand("!onjoin", OnJoinCommand)
+}
@@ -2,21 +2,22 @@ package commands
 
 import (
 	"mbot/bot"
-	"mbot/config"
 	"strings"
-
-	"github.com/ergochat/irc-go/ircevent"
 )
 
-func PersonalityCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func PersonalityCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	args := strings.SplitN(message, " ", 2)
+	personalities := connection.Network.Personalities
 
 	if len(args) < 2 || strings.TrimSpace(args[1]) == "" {
-		personality := config.GetPersonality(target)
+		personality := personalities.Get(target)
 		connection.Privmsg(target, "Current personality for this channel: "+personality)
 	} else {
 		personality := args[1]
-		config.SetPersonality(target, personality)
+		if err := personalities.Set(target, personality); err != nil {
+			connection.Privmsg(target, "Failed to save personality: "+err.Error())
+			return
+		}
 		connection.Privmsg(target, "Personality for this channel has been set to: "+personality)
 	}
 }
@@ -0,0 +1,161 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"mbot/bot"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const remindUsage = "Usage: !remind <me|nick|#channel> <in 2h30m|at 17:00|tomorrow at 9:00|on 2024-12-24 at 18:00> [to] <text>, !remind list, !remind cancel <id> or !remind tz <Area/City>"
+
+// Layout used to show when a reminder is due
+const reminderTimeLayout = "Mon 2 Jan 15:04 MST"
+
+// Handler for the !remind command
+func RemindCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)[1:]
+	nick := bot.ExtractNickname(sender)
+	account := connection.Accounts.Get(nick)
+	reminders := connection.Network.Reminders
+
+	if len(parts) == 0 {
+		connection.Privmsg(target, remindUsage)
+		return
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "list":
+		pending := reminders.CreatedBy(connection.Network.Name, nick, account)
+		if len(pending) == 0 {
+			connection.Privmsg(target, "You have no pending reminders.")
+			return
+		}
+		loc := reminders.Timezone(nick, account)
+		var lines []string
+		for _, reminder := range pending {
+			lines = append(lines, fmt.Sprintf("#%d %s for %s: %s", reminder.ID, reminder.DueAt.In(loc).Format(reminderTimeLayout), reminder.Target, reminder.Text))
+		}
+		connection.SendLong(target, "Your reminders: "+strings.Join(lines, " | "))
+		return
+
+	case "cancel":
+		id, err := 0, errors.New("missing id")
+		if len(parts) == 2 {
+			id, err = strconv.Atoi(strings.TrimPrefix(parts[1], "#"))
+		}
+		if err != nil {
+			connection.Privmsg(target, "Usage: !remind cancel <id>")
+			return
+		}
+		cancelled, err := reminders.Cancel(connection.Network.Name, id, nick, account)
+		if err != nil {
+			color.Red(">> Error saving reminders: %v", err)
+		}
+		if !cancelled {
+			connection.Privmsg(target, fmt.Sprintf("You have no pending reminder #%d.", id))
+			return
+		}
+		connection.Privmsg(target, fmt.Sprintf("Reminder #%d cancelled.", id))
+		return
+
+	case "tz", "timezone":
+		if len(parts) < 2 {
+			connection.Privmsg(target, fmt.Sprintf("Your timezone is %s. Change it with !remind tz <Area/City>.", reminders.Timezone(nick, account)))
+			return
+		}
+		loc, err := reminders.SetTimezone(nick, account, parts[1])
+		if err != nil {
+			connection.Privmsg(target, err.Error())
+			return
+		}
+		connection.Privmsg(target, fmt.Sprintf("Your timezone is now %s, where it is %s.", loc, time.Now().In(loc).Format(reminderTimeLayout)))
+		return
+	}
+
+	if len(parts) < 3 {
+		connection.Privmsg(target, remindUsage)
+		return
+	}
+
+	// Work out where the reminder goes and who it addresses
+	who := parts[0]
+	reminder := bot.Reminder{
+		Network:        connection.Network.Name,
+		Creator:        nick,
+		CreatorAccount: account,
+		Target:         target,
+	}
+	if !connection.Channels.IsChannel(target) {
+		reminder.Target = nick
+	}
+	switch {
+	case strings.EqualFold(who, "me"):
+		reminder.Mention = nick
+	case connection.Channels.IsChannel(who):
+		// Only admins of another channel may send reminders there
+		if !strings.EqualFold(who, target) && bot.GetUserRoleLevelByAccount(users, account, sender, who) < bot.RoleAdmin {
+			connection.Privmsg(target, fmt.Sprintf("You need to be an Admin in %s to set reminders there.", who))
+			return
+		}
+		reminder.Target = who
+	default:
+		reminder.Mention = who
+		if !connection.Channels.IsChannel(target) {
+			reminder.Target = who
+		}
+	}
+
+	now := time.Now()
+	loc := reminders.Timezone(nick, account)
+	due, rest, err := bot.ParseReminderTime(parts[1:], now, loc)
+	if err != nil {
+		connection.Privmsg(target, fmt.Sprintf("I don't understand when: %v. %s", err, remindUsage))
+		return
+	}
+	if len(rest) > 0 && strings.EqualFold(rest[0], "to") {
+		rest = rest[1:]
+	}
+	switch {
+	case len(rest) == 0:
+		connection.Privmsg(target, "What should I remind about? "+remindUsage)
+		return
+	case !due.After(now):
+		connection.Privmsg(target, "That time has already passed.")
+		return
+	case due.Sub(now) > bot.MaxReminderDistance:
+		connection.Privmsg(target, "That is too far away, reminders can be at most a year ahead.")
+		return
+	}
+	reminder.Text = strings.Join(rest, " ")
+	reminder.DueAt = due
+	reminder.CreatedAt = now
+
+	id, err := reminders.Add(reminder)
+	if errors.Is(err, bot.ErrTooManyReminders) {
+		connection.Privmsg(target, fmt.Sprintf("You already have %d reminders pending. Cancel some with !remind cancel <id>.", bot.MaxRemindersPerUser))
+		return
+	} else if err != nil {
+		color.Red(">> Error saving reminders: %v", err)
+		connection.Privmsg(target, "Failed to save the reminder: "+err.Error())
+		return
+	}
+
+	whom := "you"
+	if reminder.Mention == "" {
+		whom = reminder.Target
+	} else if !strings.EqualFold(reminder.Mention, nick) {
+		whom = reminder.Mention
+	}
+	connection.Privmsg(target, fmt.Sprintf("Okay, I'll remind %s in %s (%s). Reminder #%d.",
+		whom, bot.FormatDuration(due.Sub(now).Round(time.Second)), due.In(loc).Format(reminderTimeLayout), id))
+}
+
+// RegisterRemindCommand registers the !remind command
+func RegisterRemindCommand() {
+	bot.RegisterCommand("!remind", RemindCommand)
+}
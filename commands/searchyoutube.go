@@ -11,7 +11,6 @@ import (
 
 	"mbot/bot"
 
-	"github.com/ergochat/irc-go/ircevent"
 	"github.com/fatih/color"
 )
 
@@ -52,7 +51,7 @@ func SearchYouTube(query string, apiKey string) (string, error) {
 }
 
 // Handler for the !yt command
-func YTCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func YTCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	// Extract the search query from the message
 	query := strings.TrimSpace(strings.TrimPrefix(message, "!yt"))
 	if query == "" {
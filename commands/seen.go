@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"fmt"
+	"mbot/bot"
+	"strings"
+	"time"
+)
+
+const (
+	maxSeenMatchesListed = 5
+	maxSeenTextLength    = 200
+)
+
+// Handler for the !seen command
+func SeenCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)
+	if len(parts) < 2 {
+		connection.Privmsg(target, "Usage: !seen <nick> (wildcards like mat* work too)")
+		return
+	}
+	nick := parts[1]
+
+	switch {
+	case strings.EqualFold(nick, connection.CurrentNick()):
+		connection.Privmsg(target, "I'm right here!")
+		return
+	case strings.EqualFold(nick, bot.ExtractNickname(sender)):
+		connection.Privmsg(target, "Looking for yourself? You're right here.")
+		return
+	}
+
+	matches := connection.Network.Seen.Lookup(connection.Network.Name, nick)
+	if len(matches) == 0 {
+		connection.Privmsg(target, fmt.Sprintf("I haven't seen %s.", nick))
+		return
+	}
+
+	reply := describeSeen(connection, target, matches[0])
+	if len(matches) > 1 {
+		var others []string
+		for _, match := range matches[1:min(len(matches), maxSeenMatchesListed+1)] {
+			others = append(others, match.Nick)
+		}
+		more := ""
+		if len(matches)-1 > maxSeenMatchesListed {
+			more = fmt.Sprintf(" and %d more", len(matches)-1-maxSeenMatchesListed)
+		}
+		reply += fmt.Sprintf(" Other matches: %s%s.", strings.Join(others, ", "), more)
+	}
+	connection.SendLong(target, reply)
+}
+
+// Function to describe a seen record in a sentence, hiding what happened in channels that were secret
+// or private at the time unless the question is asked in that channel
+func describeSeen(connection *bot.Connection, target string, record bot.SeenRecord) string {
+	channel := record.Channel
+	text := record.Text
+	if record.Private && !strings.EqualFold(channel, target) {
+		channel = "a private channel"
+		text = ""
+	}
+	if runes := []rune(text); len(runes) > maxSeenTextLength {
+		text = string(runes[:maxSeenTextLength]) + "…"
+	}
+
+	var activity string
+	switch record.Action {
+	case bot.SeenMessage:
+		activity = fmt.Sprintf("in %s saying \"%s\"", channel, text)
+	case bot.SeenAction:
+		activity = fmt.Sprintf("in %s doing \"* %s %s\"", channel, record.Nick, text)
+	case bot.SeenJoin:
+		activity = fmt.Sprintf("joining %s", channel)
+	case bot.SeenPart:
+		activity = fmt.Sprintf("leaving %s", channel)
+	case bot.SeenKick:
+		activity = fmt.Sprintf("being kicked from %s", channel)
+	case bot.SeenQuit:
+		activity = "quitting"
+	case bot.SeenNick:
+		activity = fmt.Sprintf("changing their nick to %s", record.NewNick)
+	}
+	if text != "" && (record.Action == bot.SeenPart || record.Action == bot.SeenKick || record.Action == bot.SeenQuit) {
+		activity += fmt.Sprintf(" (%s)", text)
+	}
+	if text == "" && (record.Action == bot.SeenMessage || record.Action == bot.SeenAction) {
+		activity = fmt.Sprintf("talking in %s", channel)
+	}
+
+	reply := fmt.Sprintf("%s was last seen %s ago %s.", record.Nick, bot.FormatRoughDuration(time.Since(record.Time)), activity)
+
+	// Mention where they are now, leaving out channels the asker should not learn about
+	var here []string
+	for _, current := range connection.Channels.ChannelsOf(record.Nick) {
+		if strings.EqualFold(current, target) || !connection.Channels.IsPrivate(current) {
+			here = append(here, current)
+		}
+	}
+	if len(here) > 0 {
+		reply = fmt.Sprintf("%s is on %s right now. %s", record.Nick, strings.Join(here, ", "), reply)
+	}
+	return reply
+}
+
+// RegisterSeenCommand registers the !seen command
+func RegisterSeenCommand() {
+	bot.RegisterCommand("!seen", SeenCommand)
+}
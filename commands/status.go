@@ -0,0 +1,16 @@
+package commands
+
+import (
+	"fmt"
+	"mbot/bot"
+)
+
+// Handler for the !status command
+func StatusCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	connection.Privmsg(target, fmt.Sprintf("[%s] %s", connection.Network.Name, connection.Supervisor.Status()))
+}
+
+// RegisterStatusCommand registers the !status command
+func RegisterStatusCommand() {
+	bot.RegisterCommand("!status", StatusCommand)
+}
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"mbot/bot"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+const tellUsage = "Usage: !tell [--pm] <nick|$a:account> <message>, !tell list or !tell cancel <id>"
+
+// Handler for the !tell command
+func TellCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
+	parts := strings.Fields(message)[1:]
+	nick := bot.ExtractNickname(sender)
+	account := connection.Accounts.Get(nick)
+	memos := connection.Network.Memos
+
+	if len(parts) == 0 {
+		connection.Privmsg(target, tellUsage)
+		return
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "list":
+		pending := memos.SentBy(connection.Network.Name, nick, account)
+		if len(pending) == 0 {
+			connection.Privmsg(target, "You have no memos waiting to be delivered.")
+			return
+		}
+		var lines []string
+		for _, memo := range pending {
+			lines = append(lines, fmt.Sprintf("#%d to %s, %s ago", memo.ID, memo.To, bot.FormatRoughDuration(time.Since(memo.CreatedAt))))
+		}
+		connection.SendLong(target, "Your pending memos: "+strings.Join(lines, " | "))
+		return
+
+	case "cancel":
+		if len(parts) != 2 {
+			connection.Privmsg(target, "Usage: !tell cancel <id>")
+			return
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(parts[1], "#"))
+		if err != nil {
+			connection.Privmsg(target, "Usage: !tell cancel <id>")
+			return
+		}
+		cancelled, err := memos.Cancel(connection.Network.Name, id, nick, account)
+		if err != nil {
+			color.Red(">> Error saving memos: %v", err)
+		}
+		if !cancelled {
+			connection.Privmsg(target, fmt.Sprintf("You have no pending memo #%d.", id))
+			return
+		}
+		connection.Privmsg(target, fmt.Sprintf("Memo #%d cancelled.", id))
+		return
+	}
+
+	private := false
+	if parts[0] == "--pm" {
+		private = true
+		parts = parts[1:]
+	}
+	if len(parts) < 2 {
+		connection.Privmsg(target, tellUsage)
+		return
+	}
+	recipient := parts[0]
+	text := strings.Join(parts[1:], " ")
+
+	if strings.EqualFold(recipient, connection.CurrentNick()) {
+		connection.Privmsg(target, "I'm right here, just tell me.")
+		return
+	}
+
+	// Memos follow the recipient's account when it is given or known, so nobody can take their nick to read them
+	toAccount, isAccount := strings.CutPrefix(recipient, bot.AccountKeyPrefix)
+	if !isAccount {
+		toAccount = connection.Accounts.Get(recipient)
+	}
+
+	now := time.Now()
+	id, err := memos.Add(bot.Memo{
+		Network:     connection.Network.Name,
+		From:        nick,
+		FromAccount: account,
+		To:          recipient,
+		ToAccount:   toAccount,
+		Text:        text,
+		Private:     private,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(bot.MemoExpiry),
+	})
+	switch {
+	case errors.Is(err, bot.ErrRecipientMailboxFull):
+		connection.Privmsg(target, fmt.Sprintf("%s already has %d memos waiting, try again later.", recipient, bot.MaxMemosPerRecipient))
+		return
+	case errors.Is(err, bot.ErrTooManyMemos):
+		connection.Privmsg(target, fmt.Sprintf("You already have %d memos waiting. Cancel some with !tell cancel <id>.", bot.MaxMemosPerSender))
+		return
+	case err != nil:
+		color.Red(">> Error saving memos: %v", err)
+		connection.Privmsg(target, "Failed to save the memo: "+err.Error())
+		return
+	}
+
+	how := "the next time they speak or join"
+	if private {
+		how = "by private message " + how
+	}
+	connection.Privmsg(target, fmt.Sprintf("Memo #%d for %s saved, I'll deliver it %s.", id, recipient, how))
+}
+
+// RegisterTellCommand registers the !tell command
+func RegisterTellCommand() {
+	bot.RegisterCommand("!tell", TellCommand)
+}
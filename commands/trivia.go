@@ -15,7 +15,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/ergochat/irc-go/ircevent"
 	"github.com/fatih/color"
 	openai "github.com/sashabaranov/go-openai"
 )
@@ -27,7 +26,6 @@ type TriviaQuestion struct {
 	Answer   string `json:"answer"`
 }
 
-const triviaFile = "./data/trivia_questions.json"
 const maxQuestions = 100
 
 var triviaQuestions []TriviaQuestion
@@ -35,7 +33,7 @@ var triviaMu sync.Mutex
 
 // LoadTriviaQuestions loads the trivia questions from a JSON file
 func loadTriviaQuestions() error {
-	file, err := os.ReadFile(triviaFile)
+	file, err := os.ReadFile(bot.DataPath(bot.TriviaQuestionsFile))
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return nil // It's okay if the file doesn't exist
@@ -51,7 +49,7 @@ func saveTriviaQuestions() error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(triviaFile, data, 0644)
+	return os.WriteFile(bot.DataPath(bot.TriviaQuestionsFile), data, 0644)
 }
 
 // HashQuestion creates a hash of a given question
@@ -179,7 +177,7 @@ func GenerateTriviaQuestion(topic string) (string, string, error) {
 }
 
 // TriviaCommand handles the !trivia command, generating and starting a trivia game
-func TriviaCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func TriviaCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	bot.TriviaStateInstance.Mu.Lock()
 	defer bot.TriviaStateInstance.Mu.Unlock()
 
@@ -224,7 +222,7 @@ func TriviaCommand(connection *ircevent.Connection, sender, target, message stri
 }
 
 // StartTriviaTimer starts a 30-second timer for the trivia game
-func StartTriviaTimer(connection *ircevent.Connection, target string, answer string) {
+func StartTriviaTimer(connection *bot.Connection, target string, answer string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	bot.TriviaStateInstance.Mu.Lock()
 	bot.TriviaStateInstance.CancelFunc = cancel
@@ -248,7 +246,7 @@ func StartTriviaTimer(connection *ircevent.Connection, target string, answer str
 }
 
 // ScoresCommand handles the !trivia-top command to display user scores
-func ScoresCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func ScoresCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	fmt.Println("Scores command triggered")
 
 	bot.ScoresInstance.Mu.Lock()
@@ -319,19 +317,44 @@ func extractNickname(fullHostname string) string {
 	return fullHostname // Return as is if the format is unexpected
 }
 
-// RegisterTriviaCommand registers the trivia command
+// RegisterTriviaCommand registers the trivia command and loads the questions and scores from the data directory
 func RegisterTriviaCommand() {
 	bot.RegisterCommand("!trivia", TriviaCommand)
 	bot.RegisterCommand("!trivia-top", ScoresCommand)
-}
 
-func init() {
 	err := loadTriviaQuestions()
 	if err != nil {
 		color.Red("Failed to load trivia questions: %s", err)
 	}
 
-	if err := bot.LoadScores("./data/trivia_scores.json"); err != nil {
+	if err := bot.LoadScores(bot.DataPath(bot.TriviaScoresFile)); err != nil {
 		log.Fatalf("Error loading scores: %v", err)
 	}
 }
+
+// CheckTriviaFiles reports trivia files in the data directory that cannot be read
+func CheckTriviaFiles() error {
+	checks := []struct {
+		file string
+		into interface{}
+	}{
+		{bot.TriviaQuestionsFile, &[]TriviaQuestion{}},
+		{bot.TriviaScoresFile, &map[string]int{}},
+	}
+
+	var errs []error
+	for _, check := range checks {
+		path := bot.DataPath(check.file)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err == nil {
+			err = json.Unmarshal(data, check.into)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -5,12 +5,10 @@ import (
 	"mbot/bot"
 	"mbot/config"
 	"strings"
-
-	"github.com/ergochat/irc-go/ircevent"
 )
 
 // Handler for the !url command
-func URLCommand(connection *ircevent.Connection, sender, target, message string, users map[string]bot.User) {
+func URLCommand(connection *bot.Connection, sender, target, message string, users map[string]bot.User) {
 	// Extract command arguments
 	args := strings.Fields(message)
 	if len(args) < 3 {
@@ -33,25 +31,28 @@ func URLCommand(connection *ircevent.Connection, sender, target, message string,
 		return
 	}
 
+	network := connection.Network
+	urlConfig := network.URLConfig
+
 	// Update the feature configuration
 	switch feature {
 	case "youtube":
-		bot.URLConfigData.EnableYouTubeCheck = newState
+		urlConfig.EnableYouTubeCheck = newState
 	case "wikipedia":
-		bot.URLConfigData.EnableWikipediaCheck = newState
+		urlConfig.EnableWikipediaCheck = newState
 	case "github":
-		bot.URLConfigData.EnableGithubCheck = newState
+		urlConfig.EnableGithubCheck = newState
 	case "imdb":
-		bot.URLConfigData.EnableIMDbCheck = newState
+		urlConfig.EnableIMDbCheck = newState
 	case "virustotal":
-		bot.URLConfigData.EnableVirusTotalCheck = newState
+		urlConfig.EnableVirusTotalCheck = newState
 	default:
 		connection.Privmsg(target, fmt.Sprintf("Unknown feature: %s", feature))
 		return
 	}
 
 	// Save the updated configuration
-	err := config.SaveURLConfig(bot.URLConfigData, "./data/url_config.json")
+	err := config.SaveURLConfig(urlConfig, network.URLConfigPath())
 	if err != nil {
 		connection.Privmsg(target, fmt.Sprintf("Failed to save configuration: %v", err))
 		return
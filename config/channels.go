@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Channel features that can be turned on per channel
+const (
+	FeatureCommands = "commands" // ! commands
+	FeatureAI       = "ai"       // answers when the bot's nick is mentioned
+	FeatureURLs     = "urls"     // link titles and lookups
+	FeatureTrivia   = "trivia"   // trivia answers
+)
+
+// DefaultCommandPrefix starts commands in channels without a prefix of their own
+const DefaultCommandPrefix = "!"
+
+// Channel is one entry of the channels list. A plain string is read as a channel with just a name.
+type Channel struct {
+	Name     string   `json:"name"`
+	Key      string   `json:"key,omitempty"`
+	AutoJoin *bool    `json:"autojoin,omitempty"` // joined on connect unless false
+	Prefix   string   `json:"prefix,omitempty"`   // command prefix in this channel, "!" when empty
+	Features []string `json:"features,omitempty"` // features enabled in this channel, all of them when empty
+}
+
+// UnmarshalJSON reads a channel from its name or from an object
+func (c *Channel) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = Channel{Name: name}
+		return nil
+	}
+
+	type channel Channel // without the methods, so decoding does not recurse
+	var decoded channel
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Errorf("channel must be a name or an object: %w", err)
+	}
+	*c = Channel(decoded)
+	return nil
+}
+
+// MarshalJSON writes a channel with nothing but a name as just its name
+func (c Channel) MarshalJSON() ([]byte, error) {
+	if c.Key == "" && c.AutoJoin == nil && c.Prefix == "" && len(c.Features) == 0 {
+		return json.Marshal(c.Name)
+	}
+	type channel Channel
+	return json.Marshal(channel(c))
+}
+
+// JoinsOnConnect reports whether the bot joins the channel when it connects
+func (c Channel) JoinsOnConnect() bool {
+	return c.AutoJoin == nil || *c.AutoJoin
+}
+
+// CommandPrefix returns the prefix commands start with in the channel
+func (c Channel) CommandPrefix() string {
+	if c.Prefix == "" {
+		return DefaultCommandPrefix
+	}
+	return c.Prefix
+}
+
+// FeatureEnabled reports whether a feature is on in the channel. Channels that list no features have all of them.
+func (c Channel) FeatureEnabled(feature string) bool {
+	if len(c.Features) == 0 {
+		return true
+	}
+	for _, enabled := range c.Features {
+		if strings.EqualFold(enabled, feature) {
+			return true
+		}
+	}
+	return false
+}
+
+// Channel returns the configured entry of a channel, or an entry with just its name when it is not configured
+func (c *Config) Channel(name string) Channel {
+	for _, channel := range c.Channels {
+		if strings.EqualFold(channel.Name, name) {
+			return channel
+		}
+	}
+	return Channel{Name: name}
+}
+
+// AutoJoinChannels returns the names of the channels joined on connect
+func (c *Config) AutoJoinChannels() []string {
+	var names []string
+	for _, channel := range c.Channels {
+		if channel.JoinsOnConnect() {
+			names = append(names, channel.Name)
+		}
+	}
+	return names
+}
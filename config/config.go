@@ -8,15 +8,111 @@ import (
 )
 
 type Config struct {
-	Server       string      `json:"server"`
-	Port         string      `json:"port"`
-	Nick         string      `json:"nick"`
-	Channels     []string    `json:"channels"`
-	NickServUser string      `json:"nick_serv_user"`
-	NickServPass string      `json:"nick_serv_pass"`
-	UseTLS       bool        `json:"use_tls"`
-	TLSConfig    *tls.Config `json:"-"`
-	Features     Features    `json:"url_features"`
+	Name         string       `json:"name"`
+	Server       string       `json:"server"`
+	Port         string       `json:"port"`
+	Nick         string       `json:"nick"`
+	AltNicks     []string     `json:"alt_nicks"`
+	NickRecovery NickRecovery `json:"nick_recovery"`
+	Channels     []Channel    `json:"channels"`
+	NickServUser string       `json:"nick_serv_user"`
+	NickServPass string       `json:"nick_serv_pass"`
+	UseTLS       bool         `json:"use_tls"`
+	TLS          TLS          `json:"tls"`
+	TLSConfig    *tls.Config  `json:"-"`
+	SASL         SASL         `json:"sasl"`
+	Proxy        Proxy        `json:"proxy"`
+	Features     Features     `json:"url_features"`
+	Reconnect    Reconnect    `json:"reconnect"`
+	SendQueue    SendQueue    `json:"send_queue"`
+	Bans         Bans         `json:"bans"`
+	Protection   Protection   `json:"protection"`
+	Logging      Logging      `json:"logging"`
+	Invites      Invites      `json:"invites"`
+	Rejoin       Rejoin       `json:"rejoin"`
+	HTTP         HTTP         `json:"http"`
+	SharedData   bool         `json:"shared_data"`
+	Networks     []*Config    `json:"networks,omitempty"`
+}
+
+// Reconnect holds the backoff settings used when the connection to the server drops
+type Reconnect struct {
+	MinDelaySeconds int `json:"min_delay_seconds"`
+	MaxDelaySeconds int `json:"max_delay_seconds"`
+}
+
+// NickRecovery controls how the bot gets its nick back when it is taken.
+// Method is "regain" (default), "ghost" or "none".
+type NickRecovery struct {
+	Method               string `json:"method"`
+	CheckIntervalSeconds int    `json:"check_interval_seconds"`
+}
+
+// SendQueue holds the flood control settings for everything the bot sends
+type SendQueue struct {
+	Burst          int `json:"burst"`
+	IntervalMillis int `json:"interval_ms"`
+	MaxBacklog     int `json:"max_backlog"`
+}
+
+// Bans controls how !ban builds its mask and whether it kicks the user too.
+// MaskStyle is "host" (default), "user_host", "nick" or "full".
+type Bans struct {
+	MaskStyle string `json:"mask_style"`
+	Kick      bool   `json:"kick"`
+}
+
+// Protection holds the channel flood and spam protection settings. Zero values use the defaults.
+// Actions run in order for repeated offenses and are "warn", "quiet", "kick" and "ban".
+type Protection struct {
+	Enabled            bool     `json:"enabled"`
+	Channels           []string `json:"channels"`    // channels to protect, all of them when empty
+	ExemptRole         string   `json:"exempt_role"` // users with this role or above are never acted on
+	FloodLines         int      `json:"flood_lines"`
+	FloodSeconds       int      `json:"flood_seconds"`
+	RepeatLines        int      `json:"repeat_lines"`
+	RepeatSeconds      int      `json:"repeat_seconds"`
+	MaxHighlights      int      `json:"max_highlights"`
+	CapsPercent        int      `json:"caps_percent"`
+	CapsMinLength      int      `json:"caps_min_length"`
+	MaxFormatting      int      `json:"max_formatting"`
+	JoinPartCount      int      `json:"join_part_count"`
+	JoinPartSeconds    int      `json:"join_part_seconds"`
+	Actions            []string `json:"actions"`
+	QuietMode          string   `json:"quiet_mode"` // the list mode used to quiet, "q" on most networks
+	QuietMinutes       int      `json:"quiet_minutes"`
+	BanMinutes         int      `json:"ban_minutes"`
+	StrikeResetMinutes int      `json:"strike_reset_minutes"`
+}
+
+// Logging controls the channel logs. Dir defaults to logs/ in the network's data directory,
+// and each channel keeps at most MaxChannelMegabytes of logs when it is set.
+type Logging struct {
+	Enabled             bool     `json:"enabled"`
+	Dir                 string   `json:"dir"`
+	ExcludeChannels     []string `json:"exclude_channels"`
+	MaxChannelMegabytes int      `json:"max_channel_mb"`
+}
+
+// Invites controls which invites the bot follows. Invites from users with AcceptRole or above in the
+// invited channel are accepted, Admin when it is empty. Others is "queue" (default) to hold the rest
+// for the owner to decide on, or "ignore". AllowChannelOps also accepts invites from operators of the invited channel.
+type Invites struct {
+	AcceptRole      string `json:"accept_role"`
+	Others          string `json:"others"`
+	AllowChannelOps bool   `json:"allow_channel_ops"`
+}
+
+// Rejoin controls how the bot gets back into a channel after it is kicked. The first attempt waits
+// DelaySeconds and every failed one doubles the wait up to MaxDelaySeconds, for at most MaxAttempts.
+// With UseChanServ the bot asks ChanServ (or ChanServNick) to unban or invite it when it is banned or the channel is invite only.
+type Rejoin struct {
+	Enabled         bool   `json:"enabled"`
+	DelaySeconds    int    `json:"delay_seconds"`
+	MaxDelaySeconds int    `json:"max_delay_seconds"`
+	MaxAttempts     int    `json:"max_attempts"`
+	UseChanServ     bool   `json:"use_chanserv"`
+	ChanServNick    string `json:"chanserv_nick"`
 }
 
 type Features struct {
@@ -36,29 +132,71 @@ type CommandConfig struct {
 	Commands map[string][]CommandPermission `json:"commands"`
 }
 
-// Function to load the configuration from a file
+// Function to load the configuration from a file. Every problem in it is reported with its key path.
 func LoadConfig(filePath string) (*Config, error) {
-	file, err := os.Open(filePath)
+	config, err := CheckConfig(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// CheckConfig loads the configuration like LoadConfig, but also returns it when it has problems so the
+// files it refers to can be checked as well. The config is nil only when the file could not be read or decoded.
+func CheckConfig(filePath string) (*Config, error) {
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("error opening config file: %w", err)
 	}
-	defer file.Close()
 
 	config := &Config{}
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(config); err != nil {
-		return nil, fmt.Errorf("error decoding config file: %w", err)
+	problems, err := decodeFile(filePath, data, config)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, config.Validate(filePath)...)
+	if err := problems.Err(); err != nil {
+		return config, err
 	}
 
-	if config.UseTLS {
-		config.TLSConfig = &tls.Config{
-			InsecureSkipVerify: true,
+	for _, network := range config.NetworkConfigs() {
+		if network.UseTLS {
+			if network.TLSConfig, err = network.TLS.ClientConfig(network.Server); err != nil {
+				return config, fmt.Errorf("error setting up TLS for network %s: %w", network.Name, err)
+			}
+		}
+		if network.Proxy.Enabled() {
+			if _, err := network.Proxy.Parse(); err != nil {
+				return config, fmt.Errorf("error in the proxy of network %s: %w", network.Name, err)
+			}
+		}
+		if err := network.loadClientCertificate(); err != nil {
+			return config, fmt.Errorf("error setting up SASL for network %s: %w", network.Name, err)
 		}
 	}
 
 	return config, nil
 }
 
+// NetworkConfigs returns the configuration of every network the bot should connect to.
+// A config without a "networks" list describes a single network that uses the shared data files.
+func (c *Config) NetworkConfigs() []*Config {
+	if len(c.Networks) == 0 {
+		if c.Name == "" {
+			c.Name = "default"
+		}
+		c.SharedData = true
+		return []*Config{c}
+	}
+
+	for i, network := range c.Networks {
+		if network.Name == "" {
+			network.Name = fmt.Sprintf("network%d", i+1)
+		}
+	}
+	return c.Networks
+}
+
 // Function to save the configuration to a file
 func SaveConfig(config *Config, filePath string) error {
 	file, err := os.Create(filePath)
@@ -104,7 +242,7 @@ func saveCommandConfig(filePath string, config *CommandConfig) error {
 
 // Function to load the command configuration from a file
 func LoadCommandConfig(filePath string) (*CommandConfig, error) {
-	file, err := os.Open(filePath)
+	data, err := os.ReadFile(filePath)
 	if os.IsNotExist(err) {
 		// Create the file with default content if it does not exist
 		defaultConfig := DefaultCommandConfig()
@@ -116,12 +254,15 @@ func LoadCommandConfig(filePath string) (*CommandConfig, error) {
 	} else if err != nil {
 		return nil, fmt.Errorf("error opening command config file: %w", err)
 	}
-	defer file.Close()
 
 	commandConfig := &CommandConfig{}
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(commandConfig); err != nil {
-		return nil, fmt.Errorf("error decoding command config file: %w", err)
+	problems, err := decodeFile(filePath, data, commandConfig)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, commandConfig.Validate(filePath)...)
+	if err := problems.Err(); err != nil {
+		return nil, err
 	}
 
 	return commandConfig, nil
@@ -2,58 +2,80 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 	"sync"
 )
 
-var (
-	channelPersonalities = make(map[string]string)
-	mu                   sync.Mutex
-	filePath             = "data/personalities.json"
-)
+// DefaultPersonality is used for channels without a personality of their own
+const DefaultPersonality = "You are Mbot, an IRC bot created by Mathisen. Your version is 0.6 Alpha."
 
-func init() {
-	loadPersonalities()
+// Personalities holds the per-channel personalities stored in a single file
+type Personalities struct {
+	mu       sync.Mutex
+	filePath string
+	channels map[string]string
 }
 
-func GetPersonality(channel string) string {
-	mu.Lock()
-	defer mu.Unlock()
-	if personality, exists := channelPersonalities[channel]; exists {
-		return personality
+// LoadPersonalities loads the channel personalities from a file, starting empty if it does not exist
+func LoadPersonalities(filePath string) (*Personalities, error) {
+	p := &Personalities{
+		filePath: filePath,
+		channels: make(map[string]string),
 	}
-	return "You are Mbot, an IRC bot created by Mathisen. Your version is 0.6 Alpha."
-}
-
-func SetPersonality(channel, personality string) {
-	mu.Lock()
-	defer mu.Unlock()
-	channelPersonalities[channel] = personality
-	savePersonalities()
-}
 
-func loadPersonalities() {
-	mu.Lock()
-	defer mu.Unlock()
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// File does not exist, no personalities to load
-			return
+			return p, nil
 		}
-		panic(err)
+		return nil, fmt.Errorf("error reading personalities file: %w", err)
+	}
+	if err := DecodeFile(filePath, data, &p.channels); err != nil {
+		return nil, err
 	}
-	if err := json.Unmarshal(data, &channelPersonalities); err != nil {
-		panic(err)
+	var problems Problems
+	for _, channel := range sortedKeys(p.channels) {
+		if !ValidChannelName(channel) {
+			problems.Add(filePath, MapKeyPath("", channel), "%q is not a valid channel name", channel)
+		}
+		if strings.TrimSpace(p.channels[channel]) == "" {
+			problems.Add(filePath, MapKeyPath("", channel), "the personality is empty")
+		}
 	}
+	if err := problems.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Get returns the personality for a channel
+func (p *Personalities) Get(channel string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if personality, exists := p.channels[channel]; exists {
+		return personality
+	}
+	return DefaultPersonality
+}
+
+// Set changes the personality for a channel and saves it
+func (p *Personalities) Set(channel, personality string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.channels[channel] = personality
+	return p.save()
 }
 
-func savePersonalities() {
-	data, err := json.MarshalIndent(channelPersonalities, "", "  ")
+func (p *Personalities) save() error {
+	data, err := json.MarshalIndent(p.channels, "", "  ")
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("error encoding personalities file: %w", err)
 	}
-	if err := os.WriteFile(filePath, data, 0644); err != nil {
-		panic(err)
+	if err := os.WriteFile(p.filePath, data, 0644); err != nil {
+		return fmt.Errorf("error writing personalities file: %w", err)
 	}
+	return nil
 }
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Proxy is a SOCKS5 or HTTP CONNECT proxy the bot connects through. URL is socks5://host:port,
+// http://host:port or https://host:port. The credentials can also be given in the URL.
+type Proxy struct {
+	URL      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Enabled reports whether a proxy is set
+func (p Proxy) Enabled() bool {
+	return p.URL != ""
+}
+
+// Parse checks the proxy settings and returns its URL with the credentials in it
+func (p Proxy) Parse() (*url.URL, error) {
+	proxyURL, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch strings.ToLower(proxyURL.Scheme) {
+	case "socks5", "socks5h":
+		proxyURL.Scheme = "socks5"
+	case "http", "https":
+		proxyURL.Scheme = strings.ToLower(proxyURL.Scheme)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use socks5, http or https", proxyURL.Scheme)
+	}
+	if _, port, err := net.SplitHostPort(proxyURL.Host); err != nil || port == "" {
+		return nil, fmt.Errorf("proxy URL %s needs a host and a port", p.URL)
+	}
+	if p.Username != "" {
+		proxyURL.User = url.UserPassword(p.Username, p.Password)
+	}
+	return proxyURL, nil
+}
+
+// Redacted returns the proxy URL without the password, for logs
+func (p Proxy) Redacted() string {
+	proxyURL, err := p.Parse()
+	if err != nil {
+		return p.URL
+	}
+	return proxyURL.Redacted()
+}
+
+// httpProxy returns the proxy outgoing HTTP requests go through, nil when they connect directly
+func (c *Config) httpProxy() *Proxy {
+	if c.HTTP.Proxy != nil {
+		return c.HTTP.Proxy
+	}
+	if !c.HTTP.UseIRCProxy {
+		return nil
+	}
+	// With several networks, the first one connecting through a proxy decides
+	for _, network := range append([]*Config{c}, c.Networks...) {
+		if network.Proxy.Enabled() {
+			return &network.Proxy
+		}
+	}
+	return nil
+}
+
+// configureHTTPProxy routes a transport through the HTTP proxy setting, leaving the
+// proxy environment variables in charge when none is set
+func (c *Config) configureHTTPProxy(transport *http.Transport) error {
+	proxy := c.httpProxy()
+	if proxy == nil || !proxy.Enabled() {
+		return nil
+	}
+	proxyURL, err := proxy.Parse()
+	if err != nil {
+		return fmt.Errorf("error configuring HTTP proxy: %w", err)
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return nil
+}
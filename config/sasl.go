@@ -0,0 +1,184 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// SASL mechanisms
+const (
+	SASLExternal = "EXTERNAL"
+	SASLPlain    = "PLAIN"
+)
+
+// SASL fallbacks used when the mechanism fails
+const (
+	SASLFallbackPlain    = "plain"    // try PLAIN, then NickServ IDENTIFY
+	SASLFallbackNickServ = "nickserv" // identify to NickServ once connected
+	SASLFallbackNone     = "none"
+)
+
+// SASL controls how the bot logs in to services while connecting. EXTERNAL logs in with the client
+// certificate in CertFile and KeyFile (CertFP), PLAIN with nick_serv_user and nick_serv_pass.
+// Mechanism defaults to EXTERNAL when a certificate is set and to PLAIN when a password is.
+// When the login fails, Fallback is "plain" (default), "nickserv" or "none".
+type SASL struct {
+	Mechanism string `json:"mechanism"`
+	CertFile  string `json:"cert_file"`
+	KeyFile   string `json:"key_file"` // the key is read from CertFile when empty
+	Fallback  string `json:"fallback"`
+}
+
+// SASLMechanism returns the mechanism the bot logs in with, empty when it does not use SASL
+func (c *Config) SASLMechanism() string {
+	switch {
+	case c.SASL.Mechanism != "":
+		return strings.ToUpper(c.SASL.Mechanism)
+	case c.SASL.CertFile != "":
+		return SASLExternal
+	case c.HasNickServPassword():
+		return SASLPlain
+	}
+	return ""
+}
+
+// HasNickServPassword reports whether the bot has an account name and password
+func (c *Config) HasNickServPassword() bool {
+	return c.NickServUser != "" && c.NickServPass != ""
+}
+
+// SASLFallback returns what the bot does when SASL fails
+func (c *Config) SASLFallback() string {
+	if c.SASL.Fallback == "" {
+		return SASLFallbackPlain
+	}
+	return strings.ToLower(c.SASL.Fallback)
+}
+
+// loadClientCertificate checks the SASL settings and adds the client certificate to the TLS config
+func (c *Config) loadClientCertificate() error {
+	mechanism := c.SASLMechanism()
+	switch mechanism {
+	case "", SASLPlain, SASLExternal:
+	default:
+		return fmt.Errorf("unsupported SASL mechanism %q, use EXTERNAL or PLAIN", c.SASL.Mechanism)
+	}
+	switch c.SASLFallback() {
+	case SASLFallbackPlain, SASLFallbackNickServ, SASLFallbackNone:
+	default:
+		return fmt.Errorf("unknown SASL fallback %q, use plain, nickserv or none", c.SASL.Fallback)
+	}
+	if mechanism == SASLPlain && !c.HasNickServPassword() {
+		return errors.New("SASL PLAIN needs nick_serv_user and nick_serv_pass")
+	}
+	if c.SASL.CertFile == "" {
+		if mechanism == SASLExternal {
+			return errors.New("SASL EXTERNAL needs a client certificate in sasl.cert_file")
+		}
+		return nil
+	}
+	if !c.UseTLS {
+		return errors.New("a client certificate needs use_tls")
+	}
+
+	keyFile := c.SASL.KeyFile
+	if keyFile == "" {
+		keyFile = c.SASL.CertFile
+	}
+	certificate, err := tls.LoadX509KeyPair(c.SASL.CertFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading client certificate: %w", err)
+	}
+	c.TLSConfig.Certificates = []tls.Certificate{certificate}
+	return nil
+}
+
+// Fingerprints holds the fingerprints of a certificate in the forms services ask for
+type Fingerprints struct {
+	SHA1   string
+	SHA256 string
+	SHA512 string
+}
+
+// CertificateFingerprints returns the hex fingerprints of a DER encoded certificate
+func CertificateFingerprints(der []byte) Fingerprints {
+	sum1 := sha1.Sum(der)
+	sum256 := sha256.Sum256(der)
+	sum512 := sha512.Sum512(der)
+	return Fingerprints{
+		SHA1:   hex.EncodeToString(sum1[:]),
+		SHA256: hex.EncodeToString(sum256[:]),
+		SHA512: hex.EncodeToString(sum512[:]),
+	}
+}
+
+// GenerateClientCert writes a new self-signed client certificate and its key for SASL EXTERNAL.
+// Existing files are never overwritten.
+func GenerateClientCert(certPath, keyPath, commonName string) (Fingerprints, error) {
+	for _, path := range []string{certPath, keyPath} {
+		if _, err := os.Stat(path); err == nil {
+			return Fingerprints{}, fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return Fingerprints{}, fmt.Errorf("error generating key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return Fingerprints{}, fmt.Errorf("error generating serial number: %w", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return Fingerprints{}, fmt.Errorf("error creating certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return Fingerprints{}, fmt.Errorf("error encoding key: %w", err)
+	}
+
+	if err := writePEM(keyPath, "PRIVATE KEY", keyDER, 0600); err != nil {
+		return Fingerprints{}, err
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return Fingerprints{}, err
+	}
+	return CertificateFingerprints(der), nil
+}
+
+// writePEM writes one PEM block to a new file
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", path, err)
+	}
+	defer file.Close()
+	if err := pem.Encode(file, &pem.Block{Type: blockType, Bytes: der}); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// TLS controls how server certificates are checked. Certificates are verified against the
+// system roots, plus the ones in CAFile, unless Insecure is set.
+// Pins are "sha256/<base64>" hashes of the server's public key (SPKI) or hex SHA-256 fingerprints of
+// its certificate. A server matching a pin is trusted without a CA, so self-signed certificates work.
+type TLS struct {
+	CAFile     string   `json:"ca_file"`
+	ServerName string   `json:"server_name"` // name the certificate must be valid for, the server address when empty
+	Pins       []string `json:"pins"`
+	Insecure   bool     `json:"insecure"` // skip all checks, only for testing
+}
+
+// HTTP holds the settings of the bot's outgoing HTTP requests, such as the API clients and link lookups.
+// They go through Proxy when it is set, or through the proxy of the IRC connection with UseIRCProxy.
+type HTTP struct {
+	TLS         *TLS   `json:"tls"` // the top-level tls section when not set
+	Proxy       *Proxy `json:"proxy"`
+	UseIRCProxy bool   `json:"use_irc_proxy"`
+}
+
+// ClientConfig builds the TLS config used to connect to a server
+func (t TLS) ClientConfig(serverName string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{ServerName: serverName}
+	if t.ServerName != "" {
+		tlsConfig.ServerName = t.ServerName
+	}
+
+	if t.CAFile != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if t.Insecure {
+		target := tlsConfig.ServerName
+		if target == "" {
+			target = "outgoing HTTP requests"
+		}
+		color.Red("!! =====================================================================")
+		color.Red("!! TLS certificate verification is DISABLED for %s", target)
+		color.Red("!! Anyone on the network path can read the passwords sent over it.")
+		color.Red("!! Remove \"insecure\": true from the config as soon as you can.")
+		color.Red("!! =====================================================================")
+		tlsConfig.InsecureSkipVerify = true
+		return tlsConfig, nil
+	}
+
+	if len(t.Pins) > 0 {
+		pins, err := parsePins(t.Pins)
+		if err != nil {
+			return nil, err
+		}
+		// The pin replaces the CA check, the standard verification would reject self-signed certificates
+		tlsConfig.InsecureSkipVerify = true
+		name := tlsConfig.ServerName
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPins(name, state, pins)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// certificatePin is a parsed pin, either of the public key or of the whole certificate
+type certificatePin struct {
+	spki bool
+	hash []byte
+}
+
+// parsePins reads pins written as sha256/<base64> or as hex with optional colons
+func parsePins(values []string) ([]certificatePin, error) {
+	var pins []certificatePin
+	for _, value := range values {
+		if encoded, isSPKI := strings.CutPrefix(value, "sha256/"); isSPKI {
+			hash, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid SPKI pin %q", value)
+			}
+			pins = append(pins, certificatePin{spki: true, hash: hash})
+			continue
+		}
+		hash, err := hex.DecodeString(strings.ReplaceAll(value, ":", ""))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate fingerprint %q, use a SHA-256 fingerprint or sha256/<base64>", value)
+		}
+		pins = append(pins, certificatePin{hash: hash})
+	}
+	return pins, nil
+}
+
+// verifyPins checks that the server's certificate matches one of the pins
+func verifyPins(serverName string, state tls.ConnectionState, pins []certificatePin) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server sent no certificate")
+	}
+	leaf := state.PeerCertificates[0]
+	spki := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	fingerprint := sha256.Sum256(leaf.Raw)
+	for _, pin := range pins {
+		if pin.spki && string(pin.hash) == string(spki[:]) || !pin.spki && string(pin.hash) == string(fingerprint[:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate of %s matches no pin (fingerprint %s, sha256/%s)",
+		serverName, hex.EncodeToString(fingerprint[:]), base64.StdEncoding.EncodeToString(spki[:]))
+}
+
+// ConfigureHTTP applies the HTTP TLS and proxy settings to the default HTTP transport, which every
+// outgoing request of the bot uses
+func (c *Config) ConfigureHTTP() error {
+	settings := c.TLS
+	if c.HTTP.TLS != nil {
+		settings = *c.HTTP.TLS
+	}
+	// Pins and server names belong to the IRC server, HTTP requests go to many hosts
+	settings.Pins = nil
+	settings.ServerName = ""
+
+	tlsConfig, err := settings.ClientConfig("")
+	if err != nil {
+		return fmt.Errorf("error configuring HTTP TLS: %w", err)
+	}
+
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return errors.New("the default HTTP transport has been replaced")
+	}
+	transport.TLSClientConfig = tlsConfig
+	return c.configureHTTPProxy(transport)
+}
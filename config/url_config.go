@@ -14,18 +14,32 @@ type URLFeatures struct {
 	EnableVirusTotalCheck bool `json:"enable_virus_total_check"`
 }
 
+// DefaultURLConfig provides the URL features enabled for a network without its own file
+func DefaultURLConfig() *URLFeatures {
+	return &URLFeatures{
+		EnableYouTubeCheck: true,
+		EnableGithubCheck:  true,
+		EnableIMDbCheck:    true,
+	}
+}
+
 // Function to load the URL configuration from a file
 func LoadURLConfig(filePath string) (*URLFeatures, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		// Create the file with default content if it does not exist
+		defaultConfig := DefaultURLConfig()
+		if err := SaveURLConfig(defaultConfig, filePath); err != nil {
+			return nil, fmt.Errorf("error creating default URL config file: %w", err)
+		}
+		return defaultConfig, nil
+	} else if err != nil {
 		return nil, fmt.Errorf("error opening URL config file: %w", err)
 	}
-	defer file.Close()
 
 	urlConfig := &URLFeatures{}
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(urlConfig); err != nil {
-		return nil, fmt.Errorf("error decoding URL config file: %w", err)
+	if err := DecodeFile(filePath, data, urlConfig); err != nil {
+		return nil, err
 	}
 
 	return urlConfig, nil
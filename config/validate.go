@@ -0,0 +1,404 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Problem is one thing wrong in a config or data file
+type Problem struct {
+	File   string
+	Path   string // key path inside the file, such as networks[0].port
+	Reason string
+}
+
+// Error formats the problem as file: path: reason
+func (p Problem) Error() string {
+	if p.Path == "" {
+		return fmt.Sprintf("%s: %s", p.File, p.Reason)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.File, p.Path, p.Reason)
+}
+
+// Problems is every problem found in one or more files, usable as an error
+type Problems []Problem
+
+// Add records a problem
+func (p *Problems) Add(file, path, format string, args ...interface{}) {
+	*p = append(*p, Problem{File: file, Path: path, Reason: fmt.Sprintf(format, args...)})
+}
+
+// Error lists the problems, one per line
+func (p Problems) Error() string {
+	lines := make([]string, len(p))
+	for i, problem := range p {
+		lines[i] = problem.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Err returns the problems as an error, nil when there are none
+func (p Problems) Err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return p
+}
+
+// Summary shortens an error holding several problems to the first one and a count, to fit on one IRC line
+func Summary(err error) string {
+	var problems Problems
+	if errors.As(err, &problems) && len(problems) > 1 {
+		return fmt.Sprintf("%s (and %d more problems)", problems[0].Error(), len(problems)-1)
+	}
+	return err.Error()
+}
+
+// KeyPath joins a key to a path
+func KeyPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// IndexPath adds a list index to a path
+func IndexPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
+
+// MapKeyPath adds a map key, which may hold dots or spaces, to a path
+func MapKeyPath(path, key string) string {
+	return path + "[" + strconv.Quote(key) + "]"
+}
+
+// DecodeFile decodes JSON into v, reporting syntax errors by line and column, values of the
+// wrong type and keys v has no field for, all with the file and key path
+func DecodeFile(file string, data []byte, v interface{}) error {
+	unknown, err := decodeFile(file, data, v)
+	if err != nil {
+		return err
+	}
+	return unknown.Err()
+}
+
+// decodeFile is DecodeFile for loaders that go on to validate v. The error is for JSON that could
+// not be decoded; unknown keys are returned as problems since v is still usable with them.
+func decodeFile(file string, data []byte, v interface{}) (Problems, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		var problems Problems
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			line, column := position(data, syntaxErr.Offset)
+			problems.Add(file, "", "line %d, column %d: %s", line, column, syntaxErr)
+		case errors.As(err, &typeErr):
+			problems.Add(file, typeErr.Field, "expected %s, found %s", typeErr.Type, typeErr.Value)
+		default:
+			problems.Add(file, "", "%s", err)
+		}
+		return nil, problems
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, Problems{{File: file, Reason: err.Error()}}
+	}
+	var problems Problems
+	checkFields(file, "", raw, reflect.TypeOf(v), &problems)
+	return problems, nil
+}
+
+// position turns a byte offset into a line and column
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+// checkFields walks decoded JSON next to the type it was decoded into and reports unknown keys
+func checkFields(file, path string, value interface{}, t reflect.Type, problems *Problems) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return // a value of another form, such as a channel given as a plain name
+		}
+		for _, key := range sortedKeys(object) {
+			field, found := jsonField(t, key)
+			if !found {
+				problems.Add(file, KeyPath(path, key), "unknown field")
+				continue
+			}
+			checkFields(file, KeyPath(path, key), object[key], field.Type, problems)
+		}
+	case reflect.Map:
+		if object, isObject := value.(map[string]interface{}); isObject {
+			for _, key := range sortedKeys(object) {
+				checkFields(file, MapKeyPath(path, key), object[key], t.Elem(), problems)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if list, isList := value.([]interface{}); isList {
+			for i, item := range list {
+				checkFields(file, IndexPath(path, i), item, t.Elem(), problems)
+			}
+		}
+	}
+}
+
+// sortedKeys returns the keys of a map in order, so problems are reported in the same order every time
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonField finds the struct field a JSON key decodes into, matching case like encoding/json does
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var folded *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if name == key {
+			return field, true
+		}
+		if folded == nil && strings.EqualFold(name, key) {
+			folded = &field
+		}
+	}
+	if folded != nil {
+		return *folded, true
+	}
+	return reflect.StructField{}, false
+}
+
+// ValidChannelName reports whether a name looks like an IRC channel
+func ValidChannelName(name string) bool {
+	if len(name) < 2 || len(name) > 200 || !strings.ContainsRune("#&+!", rune(name[0])) {
+		return false
+	}
+	return !strings.ContainsAny(name, " ,\x07\r\n")
+}
+
+// ValidNick reports whether a name can be used as a nick
+func ValidNick(nick string) bool {
+	if nick == "" || strings.ContainsAny(nick, " ,*?!@.#&:\r\n") {
+		return false
+	}
+	return !strings.ContainsRune("0123456789-", rune(nick[0]))
+}
+
+// checkReadable reports a file the bot cannot read
+func checkReadable(problems *Problems, file, path, filePath string) {
+	if filePath == "" {
+		return
+	}
+	info, err := os.Stat(filePath)
+	switch {
+	case err != nil:
+		problems.Add(file, path, "cannot read %s: %v", filePath, errors.Unwrap(err))
+	case info.IsDir():
+		problems.Add(file, path, "%s is a directory", filePath)
+	default:
+		f, err := os.Open(filePath)
+		if err != nil {
+			problems.Add(file, path, "cannot read %s: %v", filePath, errors.Unwrap(err))
+			return
+		}
+		f.Close()
+	}
+}
+
+// Validate checks the settings of every network for mistakes that decoding lets through.
+// Values that only the bot package knows, such as role names, are checked there.
+func (c *Config) Validate(file string) Problems {
+	var problems Problems
+	if len(c.Networks) == 0 {
+		c.validateNetwork(file, "", &problems)
+	}
+	names := make(map[string]int)
+	for i, network := range c.Networks {
+		path := IndexPath("networks", i)
+		if network == nil {
+			problems.Add(file, path, "must be an object")
+			continue
+		}
+		if len(network.Networks) > 0 {
+			problems.Add(file, KeyPath(path, "networks"), "networks cannot be nested")
+		}
+		if network.Name != "" {
+			if first, exists := names[strings.ToLower(network.Name)]; exists {
+				problems.Add(file, KeyPath(path, "name"), "%q is already used by networks[%d]", network.Name, first)
+			} else {
+				names[strings.ToLower(network.Name)] = i
+			}
+		}
+		network.validateNetwork(file, path, &problems)
+	}
+	if c.HTTP.TLS != nil {
+		checkReadable(&problems, file, "http.tls.ca_file", c.HTTP.TLS.CAFile)
+	}
+	if c.HTTP.Proxy != nil {
+		if _, err := c.HTTP.Proxy.Parse(); err != nil {
+			problems.Add(file, "http.proxy.url", "%v", err)
+		}
+	}
+	return problems
+}
+
+// validateNetwork checks the settings of one network, found at path in the file
+func (c *Config) validateNetwork(file, path string, problems *Problems) {
+	if c.Server == "" {
+		problems.Add(file, KeyPath(path, "server"), "is required")
+	} else if strings.ContainsAny(c.Server, " /:") && !strings.HasPrefix(c.Server, "[") {
+		problems.Add(file, KeyPath(path, "server"), "%q is not a host name or address, the port goes in port", c.Server)
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		problems.Add(file, KeyPath(path, "port"), "%q is not a port from 1 to 65535", c.Port)
+	}
+	if !ValidNick(c.Nick) {
+		problems.Add(file, KeyPath(path, "nick"), "%q is not a valid nick", c.Nick)
+	}
+	for i, nick := range c.AltNicks {
+		if !ValidNick(nick) {
+			problems.Add(file, IndexPath(KeyPath(path, "alt_nicks"), i), "%q is not a valid nick", nick)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, channel := range c.Channels {
+		channelPath := IndexPath(KeyPath(path, "channels"), i)
+		if !ValidChannelName(channel.Name) {
+			problems.Add(file, channelPath, "%q is not a valid channel name", channel.Name)
+		}
+		if seen[strings.ToLower(channel.Name)] {
+			problems.Add(file, channelPath, "%s is listed more than once", channel.Name)
+		}
+		seen[strings.ToLower(channel.Name)] = true
+		if strings.ContainsAny(channel.Key, " ,") {
+			problems.Add(file, KeyPath(channelPath, "key"), "channel keys cannot contain spaces or commas")
+		}
+		if strings.ContainsAny(channel.Prefix, " ") {
+			problems.Add(file, KeyPath(channelPath, "prefix"), "command prefixes cannot contain spaces")
+		}
+		for j, feature := range channel.Features {
+			switch strings.ToLower(feature) {
+			case FeatureCommands, FeatureAI, FeatureURLs, FeatureTrivia:
+			default:
+				problems.Add(file, IndexPath(KeyPath(channelPath, "features"), j), "unknown feature %q, use %s, %s, %s or %s",
+					feature, FeatureCommands, FeatureAI, FeatureURLs, FeatureTrivia)
+			}
+		}
+	}
+	for i, channel := range c.Protection.Channels {
+		if !ValidChannelName(channel) {
+			problems.Add(file, IndexPath(KeyPath(path, "protection.channels"), i), "%q is not a valid channel name", channel)
+		}
+	}
+	for i, channel := range c.Logging.ExcludeChannels {
+		if !ValidChannelName(channel) {
+			problems.Add(file, IndexPath(KeyPath(path, "logging.exclude_channels"), i), "%q is not a valid channel name", channel)
+		}
+	}
+	if c.Logging.Dir != "" {
+		if info, err := os.Stat(c.Logging.Dir); err == nil && !info.IsDir() {
+			problems.Add(file, KeyPath(path, "logging.dir"), "%s is not a directory", c.Logging.Dir)
+		}
+	}
+
+	for _, setting := range []struct {
+		key   string
+		value int
+	}{
+		{"nick_recovery.check_interval_seconds", c.NickRecovery.CheckIntervalSeconds},
+		{"reconnect.min_delay_seconds", c.Reconnect.MinDelaySeconds},
+		{"reconnect.max_delay_seconds", c.Reconnect.MaxDelaySeconds},
+		{"send_queue.burst", c.SendQueue.Burst},
+		{"send_queue.interval_ms", c.SendQueue.IntervalMillis},
+		{"send_queue.max_backlog", c.SendQueue.MaxBacklog},
+		{"rejoin.delay_seconds", c.Rejoin.DelaySeconds},
+		{"rejoin.max_delay_seconds", c.Rejoin.MaxDelaySeconds},
+		{"rejoin.max_attempts", c.Rejoin.MaxAttempts},
+		{"logging.max_channel_mb", c.Logging.MaxChannelMegabytes},
+	} {
+		if setting.value < 0 {
+			problems.Add(file, KeyPath(path, setting.key), "cannot be negative")
+		}
+	}
+
+	if !c.UseTLS && (c.TLS.CAFile != "" || len(c.TLS.Pins) > 0) {
+		problems.Add(file, KeyPath(path, "tls"), "is only used with use_tls")
+	}
+	checkReadable(problems, file, KeyPath(path, "tls.ca_file"), c.TLS.CAFile)
+	if _, err := parsePins(c.TLS.Pins); err != nil {
+		problems.Add(file, KeyPath(path, "tls.pins"), "%v", err)
+	}
+
+	switch c.SASLMechanism() {
+	case "", SASLPlain, SASLExternal:
+	default:
+		problems.Add(file, KeyPath(path, "sasl.mechanism"), "unsupported mechanism %q, use EXTERNAL or PLAIN", c.SASL.Mechanism)
+	}
+	switch c.SASLFallback() {
+	case SASLFallbackPlain, SASLFallbackNickServ, SASLFallbackNone:
+	default:
+		problems.Add(file, KeyPath(path, "sasl.fallback"), "unknown fallback %q, use plain, nickserv or none", c.SASL.Fallback)
+	}
+	checkReadable(problems, file, KeyPath(path, "sasl.cert_file"), c.SASL.CertFile)
+	checkReadable(problems, file, KeyPath(path, "sasl.key_file"), c.SASL.KeyFile)
+
+	if c.Proxy.Enabled() {
+		if _, err := c.Proxy.Parse(); err != nil {
+			problems.Add(file, KeyPath(path, "proxy.url"), "%v", err)
+		}
+	}
+}
+
+// Validate checks the command permissions for channels that are not channel names.
+// Role names are checked by the bot package.
+func (c *CommandConfig) Validate(file string) Problems {
+	var problems Problems
+	for _, command := range sortedKeys(c.Commands) {
+		permissions := c.Commands[command]
+		commandPath := MapKeyPath("commands", command)
+		if !strings.HasPrefix(command, "!") || strings.ContainsAny(command, " \t") {
+			problems.Add(file, commandPath, "command names start with ! and have no spaces")
+		}
+		for i, permission := range permissions {
+			for j, channel := range permission.Channels {
+				if channel != "*" && !ValidChannelName(channel) {
+					problems.Add(file, IndexPath(KeyPath(IndexPath(commandPath, i), "channels"), j), "%q is not a channel name or *", channel)
+				}
+			}
+		}
+	}
+	return problems
+}
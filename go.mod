@@ -13,6 +13,7 @@ require (
 	github.com/liushuangls/go-anthropic/v2 v2.6.0
 	github.com/sashabaranov/go-openai v1.26.3
 	github.com/yuin/goldmark v1.7.4
+	golang.org/x/net v0.25.0
 	golang.org/x/time v0.5.0
 )
 
@@ -47,7 +48,6 @@ require (
 	github.com/ugorji/go/codec v1.2.12 // indirect
 	golang.org/x/arch v0.8.0 // indirect
 	golang.org/x/crypto v0.23.0 // indirect
-	golang.org/x/net v0.25.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
 	google.golang.org/protobuf v1.34.1 // indirect
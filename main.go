@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"mbot/bot"
 	"mbot/commands"
@@ -9,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -17,21 +21,63 @@ import (
 
 var server *http.Server
 
-const (
-	// Config paths
-	ConfigPath        = "./data/config.json"
-	CommandConfigPath = "./data/command_permissions.json"
-	UserDataPath      = "./data/users.json"
-	URLConfigPath     = "./data/url_config.json"
-)
+// legacyUploadsDir is where uploaded images were kept before they moved into the data directory
+const legacyUploadsDir = "uploads"
+
+// Options set on the command line
+type Options struct {
+	DataDir    string
+	ConfigPath string
+	WebAddr    string
+}
+
+const usage = `Usage: mbot [flags] [command] [arguments]
+
+Commands:
+  run                              connect to the configured networks (the default)
+  check-config                     load and check the config and all data files, then exit
+  version                          print the version and exit
+  gencert [cert] [key] [name]      write a self-signed client certificate for SASL EXTERNAL
+
+Flags:
+`
 
 // Main function
 func main() {
+	options, command, args := parseCommandLine(os.Args[1:])
+	bot.SetDataDir(options.DataDir)
+
+	switch command {
+	case "run":
+		run(options)
+	case "check-config":
+		if err := checkConfig(options); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("Configuration OK")
+	case "version":
+		fmt.Println(bot.Version())
+	case "gencert":
+		// Generate a client certificate for SASL EXTERNAL instead of running the bot
+		if err := generateCertificate(args); err != nil {
+			log.Fatalf("Failed to generate certificate: %v", err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// run starts a bot for every network and the web server, until a signal stops them
+func run(options Options) {
 	// Load environment variables
 	bot.LoadEnv()
 
 	// Load all configurations
-	if err := loadAllConfigs(); err != nil {
+	networks, err := loadAllConfigs(options)
+	if err != nil {
 		log.Fatalf("Failed to load configurations: %v", err)
 		os.Exit(1)
 	}
@@ -39,26 +85,39 @@ func main() {
 	// Register commands
 	registerCommands()
 
-	// Initialize and start the bot
-	b := bot.NewBot(bot.ConfigData, bot.Users)
-	if err := b.Connect(); err != nil {
-		log.Fatalf("Failed to connect: %v", err)
+	// Initialize and start one bot per network
+	var bots []*bot.Bot
+	for _, network := range networks {
+		b := bot.NewBot(network)
+		if err := b.Connect(); err != nil {
+			log.Fatalf("Failed to connect to %s: %v", network.Name, err)
+		}
+		bots = append(bots, b)
 	}
 
 	// Handle OS signals
 	stopChan := make(chan os.Signal, 1)
 	signal.Notify(stopChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Run bot and web server concurrently
-	go b.Loop()
-	go web.StartWebServer()
+	// Run bots and web server concurrently
+	for _, b := range bots {
+		go b.Loop()
+	}
+	if options.WebAddr != "" {
+		go web.StartWebServer(web.Options{
+			Addr:         options.WebAddr,
+			TemplatePath: bot.AssetPath("web/template.html"),
+			StaticDir:    bot.AssetPath("web/static"),
+			UploadsDir:   uploadsDir(),
+		})
+	}
 
 	// Block until a signal is received
 	sig := <-stopChan
 	log.Printf("Received signal: %s. Shutting down...", sig)
 
-	// Gracefully shut down the bot
-	bot.ShutdownBot(b.Connection.Connection)
+	// Gracefully shut down the bots
+	bot.ShutdownBot(bots[0].Connection)
 
 	// Gracefully shut down the web server
 	shutdownWebServer()
@@ -69,41 +128,120 @@ func main() {
 // There may be better ways to handle this, but this is a simple and effective solution for now!. (im also lazy at the moment)
 // =============================================================================================================================
 
-// Main helper function to load all configurations
-func loadAllConfigs() error {
-	var err error
+// Main helper function to read the flags and the command. Flags can come before or after the command.
+func parseCommandLine(arguments []string) (Options, string, []string) {
+	var options Options
+	flags := flag.CommandLine
+	flags.StringVar(&options.DataDir, "data-dir", bot.DefaultDataDir, "directory holding the data files")
+	flags.StringVar(&options.ConfigPath, "config", "", "config file (default config.json in the data directory)")
+	flags.StringVar(&options.WebAddr, "web-addr", ":8787", "address of the paste web server, empty to disable it")
+	flag.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	flags.Parse(arguments)
+	command := "run"
+	args := flags.Args()
+	if len(args) > 0 {
+		command = args[0]
+		flags.Parse(args[1:])
+		args = flags.Args()
+	}
 
+	if options.ConfigPath == "" {
+		options.ConfigPath = filepath.Join(options.DataDir, "config.json")
+	}
+	return options, command, args
+}
+
+// Main helper function to load all configurations
+func loadAllConfigs(options Options) ([]*bot.Network, error) {
 	// Load main configuration
-	bot.ConfigData, err = config.LoadConfig(ConfigPath)
+	cfg, err := config.LoadConfig(options.ConfigPath)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := bot.ValidateConfig(cfg, options.ConfigPath); err != nil {
+		return nil, err
 	}
 
-	// Load command configuration
-	bot.CommandConfigData, err = config.LoadCommandConfig(CommandConfigPath)
-	if err != nil {
-		return err
+	// Outgoing HTTP requests check certificates and use proxies the way the config says
+	if err := cfg.ConfigureHTTP(); err != nil {
+		return nil, err
 	}
 
-	// Load URL configuration
-	bot.URLConfigData, err = config.LoadURLConfig(URLConfigPath)
-	if err != nil {
+	// Load users, command permissions, URL settings and personalities for every network
+	return bot.LoadNetworks(cfg)
+}
+
+// Main helper function to find the directory uploaded images are kept in. Older versions kept them in
+// ./uploads, which stays in use until it is moved into the data directory.
+func uploadsDir() string {
+	dir := bot.DataPath(bot.UploadsDirectory)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		return dir
+	}
+	if info, err := os.Stat(legacyUploadsDir); err == nil && info.IsDir() {
+		log.Printf("Serving uploads from %s, move it to %s to keep them with the other data files", legacyUploadsDir, dir)
+		return legacyUploadsDir
+	}
+	return dir
+}
+
+// Main helper function for check-config, which loads every file the bot would without changing any,
+// and reports every problem it finds in one go
+func checkConfig(options Options) error {
+	cfg, err := config.CheckConfig(options.ConfigPath)
+	if cfg == nil {
 		return err
 	}
+	errs := []error{err}
+	if err == nil {
+		if err := cfg.ConfigureHTTP(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", options.ConfigPath, err))
+		}
+	}
+	errs = append(errs, bot.ValidateConfig(cfg, options.ConfigPath), bot.CheckNetworks(cfg), commands.CheckTriviaFiles())
+	return errors.Join(errs...)
+}
+
+// Main helper function for "gencert [cert file] [key file] [name]", which writes a self-signed
+// client certificate and prints the fingerprints to register with NickServ
+func generateCertificate(args []string) error {
+	certPath := bot.DataPath("client.crt")
+	keyPath := bot.DataPath("client.key")
+	name := "mbot"
+	if len(args) > 0 {
+		certPath = args[0]
+	}
+	if len(args) > 1 {
+		keyPath = args[1]
+	}
+	if len(args) > 2 {
+		name = args[2]
+	}
 
-	// Load users
-	bot.Users, err = bot.LoadUsers(UserDataPath)
+	fingerprints, err := config.GenerateClientCert(certPath, keyPath, name)
 	if err != nil {
 		return err
 	}
-
+	fmt.Printf("Certificate written to %s and key to %s\n\n", certPath, keyPath)
+	fmt.Println("Fingerprints:")
+	fmt.Println("  SHA-1:  ", fingerprints.SHA1)
+	fmt.Println("  SHA-256:", fingerprints.SHA256)
+	fmt.Println("  SHA-512:", fingerprints.SHA512)
+	fmt.Println()
+	fmt.Println("Connect once with the certificate while identified and register it with services,")
+	fmt.Println("for example \"/msg NickServ CERT ADD\" which picks up the fingerprint of the connection.")
+	fmt.Println("Then set sasl.cert_file and sasl.key_file in the config.")
 	return nil
 }
 
 // Main helper function to register all commands
 func registerCommands() {
 	commands.RegisterAllCommands()
-	commands.RegisterManageCommand(bot.CommandConfigData, CommandConfigPath)
+	commands.RegisterManageCommand()
 }
 
 // Function to gracefully shut down the web server
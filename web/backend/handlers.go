@@ -24,9 +24,22 @@ type Entry struct {
 var (
 	store = make(map[string]Entry)
 	mu    sync.Mutex
-	tmpl  = template.Must(template.ParseFiles("./web/template.html")) // Load and parse the template file
+	tmpl  *template.Template
+
+	// UploadsDir is where uploaded images are stored
+	UploadsDir = "uploads"
 )
 
+// LoadTemplate loads and parses the page template
+func LoadTemplate(path string) error {
+	parsed, err := template.ParseFiles(path)
+	if err != nil {
+		return err
+	}
+	tmpl = parsed
+	return nil
+}
+
 func HandleCreate(c *gin.Context) {
 	var request struct {
 		Answer string `json:"answer"`
@@ -145,7 +158,7 @@ func HandleUploadImage(c *gin.Context) {
 	fileID := uuid.New().String()
 	fileExtension := filepath.Ext(fileHeader.Filename)
 	fileName := fileID + fileExtension
-	filePath := "uploads/" + fileName
+	filePath := filepath.Join(UploadsDir, fileName)
 	if err := c.SaveUploadedFile(fileHeader, filePath); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
 		return
@@ -158,7 +171,7 @@ func HandleUploadImage(c *gin.Context) {
 
 func HandleViewImage(c *gin.Context) {
 	imageID := c.Param("imageID")
-	filePath := "uploads/" + imageID // Construct the file path where images are stored
+	filePath := filepath.Join(UploadsDir, filepath.Base(imageID)) // Construct the file path where images are stored
 
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
@@ -26,7 +26,21 @@ func RateLimiterMiddleware(maxBurst int, refillTime time.Duration) gin.HandlerFu
 	}
 }
 
-func StartWebServer() {
+// Options holds the address the web server listens on and where its files are
+type Options struct {
+	Addr         string
+	TemplatePath string
+	StaticDir    string
+	UploadsDir   string
+}
+
+func StartWebServer(options Options) {
+	if err := mod.LoadTemplate(options.TemplatePath); err != nil {
+		log.Printf("Web server not started, failed to load the template: %v", err)
+		return
+	}
+	mod.UploadsDir = options.UploadsDir
+
 	// Start the web server
 	r := gin.Default()
 
@@ -34,10 +48,10 @@ func StartWebServer() {
 	r.Use(RateLimiterMiddleware(5, time.Second))
 
 	// Serve static files from the web/static directory
-	r.Static("/static", "./web/static")
+	r.Static("/static", options.StaticDir)
 
 	// Serve the uploads directory (assuming you create this directory)
-	r.Static("/web/uploads", "./web/uploads")
+	r.Static("/web/uploads", options.UploadsDir)
 
 	// Public routes
 	r.GET("/images/:id", mod.HandleViewImage)
@@ -57,5 +71,5 @@ func StartWebServer() {
 	// log.Fatal(r.RunTLS(":8787", "/etc/apache2/ssl/certificate.crt", "/etc/apache2/ssl/private.key"))
 
 	// Run HTTP server for local testing
-	log.Fatal(r.Run(":8787"))
+	log.Fatal(r.Run(options.Addr))
 }